@@ -28,6 +28,23 @@ const (
 	Containerd Runtime = "containerd"
 )
 
+// Well-known annotations set on the manifest of a kata artifact (payload). Their values
+// are used as defaults for the settings of the runtime class the artifact is installed for.
+const (
+	// AnnotationKataConfig is the name of the kata configuration file contained in the artifact
+	AnnotationKataConfig = "com.nvidia.kata.config"
+	// AnnotationRuntimeType is the runtime type (shim) the artifact is built for, e.g. io.containerd.kata.v2
+	AnnotationRuntimeType = "com.nvidia.kata.runtime-type"
+	// AnnotationOverheadCPU is the recommended CPU pod overhead, e.g. 250m
+	AnnotationOverheadCPU = "com.nvidia.kata.overhead.cpu"
+	// AnnotationOverheadMemory is the recommended memory pod overhead, e.g. 160Mi
+	AnnotationOverheadMemory = "com.nvidia.kata.overhead.memory"
+	// AnnotationRequiredHostFeatures is a comma-separated list of host features required by the artifact
+	AnnotationRequiredHostFeatures = "com.nvidia.kata.required-host-features"
+	// AnnotationMinManagerVersion is the minimum version of the kata manager able to install the artifact
+	AnnotationMinManagerVersion = "com.nvidia.kata.min-manager-version"
+)
+
 func (r Runtime) String() string {
 	switch r {
 	case CRIO:
@@ -17,6 +17,8 @@
 package config
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/klog/v2"
 )
@@ -30,9 +32,39 @@ type Config struct {
 	// +kubebuilder:default=/opt/nvidia-gpu-operator/artifacts/runtimeclasses
 	ArtifactsDir string `json:"artifactsDir,omitempty"    yaml:"artifactsDir,omitempty"`
 
+	// MaxArtifactSize is the maximum total size of the layers of an artifact (payload).
+	// Artifacts exceeding it are not pulled. No limit is enforced if unset.
+	// +optional
+	MaxArtifactSize *resource.Quantity `json:"maxArtifactSize,omitempty" yaml:"maxArtifactSize,omitempty"`
 	// RuntimeClasses is a list of kata runtime classes to configure.
 	// +optional
 	RuntimeClasses []RuntimeClass `json:"runtimeClasses,omitempty"  yaml:"runtimeClasses,omitempty"`
+
+	// KernelModules is the list of kernel modules loaded on the host before the runtime
+	// classes are installed. Defaults to vhost-vsock and vhost-net.
+	// +optional
+	KernelModules []KernelModule `json:"kernelModules,omitempty"   yaml:"kernelModules,omitempty"`
+}
+
+// KernelModule defines a kernel module loaded on the host
+// +kubebuilder:object:generate=true
+type KernelModule struct {
+	// Name is the name of the kernel module, e.g. vfio-pci.
+	Name string `json:"name"                 yaml:"name"`
+
+	// Parameters are the module parameters passed to modprobe, in the key=value form.
+	// +optional
+	Parameters []string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+
+	// Optional skips the module if it is not available in the host kernel instead of
+	// failing the installation, e.g. for kvm_amd and kvm_intel.
+	// +optional
+	Optional bool `json:"optional,omitempty"   yaml:"optional,omitempty"`
+
+	// Persist configures the host to load the module at boot through /etc/modules-load.d.
+	// Its parameters are persisted to /etc/modprobe.d.
+	// +optional
+	Persist bool `json:"persist,omitempty"    yaml:"persist,omitempty"`
 }
 
 // RuntimeClass defines the configuration for a kata RuntimeClass
@@ -49,6 +81,91 @@ type RuntimeClass struct {
 
 	// Artifacts are the kata artifacts associated with the runtime class.
 	Artifacts Artifacts `json:"artifacts"              yaml:"artifacts"`
+
+	// KataConfig is the name of the kata configuration file contained in the artifact.
+	// Defaults to the com.nvidia.kata.config annotation of the artifact manifest, or
+	// to the first TOML file found in the artifact.
+	// +optional
+	KataConfig string `json:"kataConfig,omitempty"   yaml:"kataConfig,omitempty"`
+
+	// RuntimeType is the runtime type (shim) used for the runtime class, e.g. io.containerd.kata.v2.
+	// With CRI-O, only the oci, vm and pod runtime types are supported.
+	// Defaults to the com.nvidia.kata.runtime-type annotation of the artifact manifest.
+	// +optional
+	RuntimeType string `json:"runtimeType,omitempty"  yaml:"runtimeType,omitempty"`
+
+	// Overhead is the pod overhead set on the existing RuntimeClass object once the
+	// runtime class is installed.
+	// Defaults to the com.nvidia.kata.overhead.* annotations of the artifact manifest.
+	// +optional
+	Overhead *Overhead `json:"overhead,omitempty"     yaml:"overhead,omitempty"`
+
+	// Runtime holds the container runtime settings for the runtime class.
+	// +optional
+	Runtime RuntimeOptions `json:"runtime,omitempty"      yaml:"runtime,omitempty"`
+}
+
+// RuntimeOptions defines the container runtime (containerd / CRI-O) settings of a kata RuntimeClass.
+// Settings not supported by the configured container runtime are ignored with a warning.
+// +kubebuilder:object:generate=true
+type RuntimeOptions struct {
+	// RuntimePath is the path to the runtime (shim) binary.
+	// +optional
+	RuntimePath string `json:"runtimePath,omitempty"                  yaml:"runtimePath,omitempty"`
+
+	// Snapshotter is the snapshotter used for containers of the runtime class (containerd only).
+	// +optional
+	Snapshotter string `json:"snapshotter,omitempty"                  yaml:"snapshotter,omitempty"`
+
+	// PodAnnotations is the list of pod annotations passed to the runtime.
+	// Defaults to io.katacontainers.*
+	// +optional
+	PodAnnotations []string `json:"podAnnotations,omitempty"               yaml:"podAnnotations,omitempty"`
+
+	// ContainerAnnotations is the list of container annotations passed to the runtime.
+	// +optional
+	ContainerAnnotations []string `json:"containerAnnotations,omitempty"         yaml:"containerAnnotations,omitempty"`
+
+	// SandboxMode is the sandbox mode of the runtime, e.g. podsandbox or shim (containerd only).
+	// +optional
+	SandboxMode string `json:"sandboxMode,omitempty"                  yaml:"sandboxMode,omitempty"`
+
+	// PrivilegedWithoutHostDevices prevents host devices from being passed to privileged containers.
+	// Defaults to true.
+	// +optional
+	PrivilegedWithoutHostDevices *bool `json:"privilegedWithoutHostDevices,omitempty" yaml:"privilegedWithoutHostDevices,omitempty"`
+
+	// Cgroup holds the cgroup settings of the runtime.
+	// +optional
+	Cgroup CgroupOptions `json:"cgroup,omitempty"                       yaml:"cgroup,omitempty"`
+
+	// Default configures the runtime class as the default runtime of the container runtime.
+	// +optional
+	Default bool `json:"default,omitempty"                      yaml:"default,omitempty"`
+}
+
+// CgroupOptions defines the cgroup settings of a kata RuntimeClass
+// +kubebuilder:object:generate=true
+type CgroupOptions struct {
+	// SystemdCgroup configures the shim to use the systemd cgroup driver (containerd only).
+	// +optional
+	SystemdCgroup *bool `json:"systemdCgroup,omitempty"  yaml:"systemdCgroup,omitempty"`
+
+	// Writable makes the cgroup hierarchy writable from within the container (containerd only).
+	// +optional
+	Writable *bool `json:"writable,omitempty"       yaml:"writable,omitempty"`
+
+	// MonitorCgroup is the cgroup used for the container monitor process (CRI-O only).
+	// +optional
+	MonitorCgroup string `json:"monitorCgroup,omitempty"  yaml:"monitorCgroup,omitempty"`
+}
+
+// Overhead defines the resource overhead associated with running a pod for a RuntimeClass
+// +kubebuilder:object:generate=true
+type Overhead struct {
+	// PodFixed represents the fixed resource overhead associated with running a pod.
+	// +optional
+	PodFixed corev1.ResourceList `json:"podFixed,omitempty" yaml:"podFixed,omitempty"`
 }
 
 // Artifacts defines the path to an OCI artifact (payload) containing all artifacts
@@ -67,7 +184,16 @@ type Artifacts struct {
 // NewDefaultConfig returns a new default config.
 func NewDefaultConfig() *Config {
 	return &Config{
-		ArtifactsDir: DefaultKataArtifactsDir,
+		ArtifactsDir:  DefaultKataArtifactsDir,
+		KernelModules: DefaultKernelModules(),
+	}
+}
+
+// DefaultKernelModules returns the kernel modules required for kata workloads
+func DefaultKernelModules() []KernelModule {
+	return []KernelModule{
+		{Name: "vhost-vsock"},
+		{Name: "vhost-net"},
 	}
 }
 
@@ -91,4 +217,15 @@ func SanitizeConfig(c *Config) {
 	}
 
 	c.RuntimeClasses = c.RuntimeClasses[:i]
+
+	i = 0
+	for idx, module := range c.KernelModules {
+		if module.Name == "" {
+			klog.Warningf("empty kernel module name, skipping entry at index %d", idx)
+			continue
+		}
+		c.KernelModules[i] = module
+		i++
+	}
+	c.KernelModules = c.KernelModules[:i]
 }
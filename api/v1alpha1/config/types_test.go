@@ -136,6 +136,24 @@ func TestSanitizeConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "empty kernel module name sanitized",
+			inputConfig: &Config{
+				ArtifactsDir: DefaultKataArtifactsDir,
+				KernelModules: []KernelModule{
+					{Name: "vfio-pci", Parameters: []string{"ids=10de:2331"}},
+					{Name: ""},
+					{Name: "kvm_amd", Optional: true},
+				},
+			},
+			expectedConfig: &Config{
+				ArtifactsDir: DefaultKataArtifactsDir,
+				KernelModules: []KernelModule{
+					{Name: "vfio-pci", Parameters: []string{"ids=10de:2331"}},
+					{Name: "kvm_amd", Optional: true},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -22,6 +22,7 @@ limitations under the License.
 package config
 
 import (
+	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -40,9 +41,39 @@ func (in *Artifacts) DeepCopy() *Artifacts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CgroupOptions) DeepCopyInto(out *CgroupOptions) {
+	*out = *in
+	if in.SystemdCgroup != nil {
+		in, out := &in.SystemdCgroup, &out.SystemdCgroup
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Writable != nil {
+		in, out := &in.Writable, &out.Writable
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CgroupOptions.
+func (in *CgroupOptions) DeepCopy() *CgroupOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(CgroupOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
+	if in.MaxArtifactSize != nil {
+		in, out := &in.MaxArtifactSize, &out.MaxArtifactSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 	if in.RuntimeClasses != nil {
 		in, out := &in.RuntimeClasses, &out.RuntimeClasses
 		*out = make([]RuntimeClass, len(*in))
@@ -50,6 +81,13 @@ func (in *Config) DeepCopyInto(out *Config) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.KernelModules != nil {
+		in, out := &in.KernelModules, &out.KernelModules
+		*out = make([]KernelModule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Config.
@@ -70,6 +108,48 @@ func (in *Config) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelModule) DeepCopyInto(out *KernelModule) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelModule.
+func (in *KernelModule) DeepCopy() *KernelModule {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelModule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Overhead) DeepCopyInto(out *Overhead) {
+	*out = *in
+	if in.PodFixed != nil {
+		in, out := &in.PodFixed, &out.PodFixed
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Overhead.
+func (in *Overhead) DeepCopy() *Overhead {
+	if in == nil {
+		return nil
+	}
+	out := new(Overhead)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RuntimeClass) DeepCopyInto(out *RuntimeClass) {
 	*out = *in
@@ -81,6 +161,12 @@ func (in *RuntimeClass) DeepCopyInto(out *RuntimeClass) {
 		}
 	}
 	out.Artifacts = in.Artifacts
+	if in.Overhead != nil {
+		in, out := &in.Overhead, &out.Overhead
+		*out = new(Overhead)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Runtime.DeepCopyInto(&out.Runtime)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeClass.
@@ -92,3 +178,34 @@ func (in *RuntimeClass) DeepCopy() *RuntimeClass {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuntimeOptions) DeepCopyInto(out *RuntimeOptions) {
+	*out = *in
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ContainerAnnotations != nil {
+		in, out := &in.ContainerAnnotations, &out.ContainerAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrivilegedWithoutHostDevices != nil {
+		in, out := &in.PrivilegedWithoutHostDevices, &out.PrivilegedWithoutHostDevices
+		*out = new(bool)
+		**out = **in
+	}
+	in.Cgroup.DeepCopyInto(&out.Cgroup)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeOptions.
+func (in *RuntimeOptions) DeepCopy() *RuntimeOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(RuntimeOptions)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/dryrun"
+	"github.com/NVIDIA/k8s-kata-manager/internal/manager"
+)
+
+// dryRun runs the installation pipeline against read-only inputs and prints the
+// changes it would make to the host as a unified diff, followed by a plan in JSON
+// format. Neither the host nor the runtime are modified.
+func (w *worker) dryRun(ctx context.Context, m *manager.Manager) error {
+	plan, err := m.DryRun(ctx)
+	if err != nil {
+		return err
+	}
+	return w.writePlan(plan)
+}
+
+// writePlan prints the diff of the plan to stdout and writes the plan in JSON
+// format to the plan file, or to stdout if no plan file is set
+func (w *worker) writePlan(plan *dryrun.Plan) error {
+	if err := plan.WriteDiff(os.Stdout); err != nil {
+		return fmt.Errorf("unable to write diff: %w", err)
+	}
+
+	if w.PlanFile == "" {
+		return plan.WriteJSON(os.Stdout)
+	}
+
+	f, err := os.Create(w.PlanFile)
+	if err != nil {
+		return fmt.Errorf("unable to open '%s' for writing: %w", w.PlanFile, err)
+	}
+	defer f.Close()
+
+	if err := plan.WriteJSON(f); err != nil {
+		return fmt.Errorf("unable to write plan: %w", err)
+	}
+	return f.Close()
+}
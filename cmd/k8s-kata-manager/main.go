@@ -17,31 +17,34 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/pelletier/go-toml"
+	"github.com/NVIDIA/go-nvlib/pkg/nvpci"
 	"github.com/urfave/cli/v2"
 	"github.com/urfave/cli/v2/altsrc"
-	"golang.org/x/sys/unix"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
-	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 
 	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
 	"github.com/NVIDIA/k8s-kata-manager/internal/cdi"
 	k8sclient "github.com/NVIDIA/k8s-kata-manager/internal/client-go"
-	"github.com/NVIDIA/k8s-kata-manager/internal/kata/transform"
-	"github.com/NVIDIA/k8s-kata-manager/internal/oras"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/manager"
+	"github.com/NVIDIA/k8s-kata-manager/internal/metrics"
 	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
 	containerd "github.com/NVIDIA/k8s-kata-manager/internal/runtime/containerd"
 	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/crio"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 	"github.com/NVIDIA/k8s-kata-manager/internal/version"
 )
 
@@ -49,15 +52,8 @@ const (
 	defaultContainerdConfigFilePath = "/etc/containerd/config.toml"
 	defaultContainerdSocketFilePath = "/run/containerd/containerd.sock"
 	defaultCrioConfigFilePath       = "/etc/crio/crio.conf"
-
-	cdiRoot = "/var/run/cdi"
-)
-
-var waitingForSignal = make(chan bool, 1)
-var signalReceived = make(chan bool, 1)
-
-var (
-	pidFile = filepath.Join(api.DefaultKataArtifactsDir, "k8s-kata-manager.pid")
+	defaultCrioDropInFilePath       = "/etc/crio/crio.conf.d/99-nvidia-kata.conf"
+	defaultCrioSocketFilePath       = "/var/run/crio/crio.sock"
 )
 
 // Worker is the interface for k8s-kata-manager daemon
@@ -70,13 +66,29 @@ type worker struct {
 	Config         *api.Config
 	Namespace      string
 	ConfigFilePath string
+	HostRoot       string
 
 	ContainerdConfig  string
+	ContainerdDropIn  string
 	ContainerdSocket  string
 	LoadKernelModules bool
 	CDIEnabled        bool
 	Runtime           string
 	CrioConfig        string
+	CrioDropIn        string
+	CrioSocket        string
+	DryRun            bool
+	PlanFile          string
+
+	RuntimeReadyTimeout time.Duration
+	RestartStrategy     string
+	RestartUnit         string
+	RestartCommand      string
+
+	MetricsBindAddress string
+	CleanupPolicy      string
+	ReconcileInterval  time.Duration
+	WatchRuntimeConfig bool
 }
 
 // newWorker returns a new worker struct
@@ -121,23 +133,36 @@ func main() {
 			Destination: &worker.Namespace,
 			EnvVars:     []string{"POD_NAMESPACE"},
 		},
+		&cli.StringFlag{
+			Name:        "host-root",
+			Usage:       "Path the host root filesystem is mounted at. The runtime configs, sockets, artifacts and CDI directories and sysfs are paths on the host resolved against it",
+			Value:       manager.DefaultHostRoot,
+			Destination: &worker.HostRoot,
+			EnvVars:     []string{"HOST_ROOT"},
+		},
 		&cli.StringFlag{
 			Name:        "containerd-config",
-			Usage:       "Path to the containerd config file",
+			Usage:       "Path to the containerd config file on the host",
 			Value:       defaultContainerdConfigFilePath,
 			Destination: &worker.ContainerdConfig,
 			EnvVars:     []string{"CONTAINERD_CONFIG"},
 		},
+		&cli.StringFlag{
+			Name:        "containerd-drop-in-config",
+			Usage:       "Path to a drop-in config file for the kata runtimes, imported by the containerd config file (e.g. /etc/containerd/conf.d/99-nvidia-kata.toml); requires containerd config version 3. If unset, the containerd config file is edited directly",
+			Destination: &worker.ContainerdDropIn,
+			EnvVars:     []string{"CONTAINERD_DROP_IN_CONFIG"},
+		},
 		&cli.StringFlag{
 			Name:        "containerd-socket",
-			Usage:       "Path to the containerd socket file",
+			Usage:       "Path to the containerd socket file on the host",
 			Value:       defaultContainerdSocketFilePath,
 			Destination: &worker.ContainerdSocket,
 			EnvVars:     []string{"CONTAINERD_SOCKET"},
 		},
 		&cli.BoolFlag{
 			Name:        "load-kernel-modules",
-			Usage:       "Load kernel modules needed to run Kata workloads",
+			Usage:       "Load the kernel modules listed in the config (vhost-vsock and vhost-net by default) needed to run Kata workloads",
 			Value:       true,
 			Destination: &worker.LoadKernelModules,
 			EnvVars:     []string{"LOAD_KERNEL_MODULES"},
@@ -151,17 +176,96 @@ func main() {
 		},
 		&cli.StringFlag{
 			Name:        "runtime",
-			Usage:       "Runtime name",
+			Usage:       "Container runtime to configure (containerd or crio). If unset, the runtime is detected from the node status and the host",
 			Value:       "",
 			Destination: &worker.Runtime,
 			EnvVars:     []string{"RUNTIME"},
 		},
 		&cli.StringFlag{
 			Name:        "crio-config",
-			Usage:       "Path to the CRI-O config file",
+			Usage:       "Deprecated: the CRI-O config file is no longer modified, see --crio-drop-in-config",
 			Value:       defaultCrioConfigFilePath,
 			Destination: &worker.CrioConfig,
 			EnvVars:     []string{"CRIO_CONFIG"},
+			Hidden:      true,
+		},
+		&cli.StringFlag{
+			Name:        "crio-drop-in-config",
+			Usage:       "Path to the CRI-O drop-in config file on the host the kata runtimes are written to",
+			Value:       defaultCrioDropInFilePath,
+			Destination: &worker.CrioDropIn,
+			EnvVars:     []string{"CRIO_DROP_IN_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:        "crio-socket",
+			Usage:       "Path to the CRI-O socket file on the host",
+			Value:       defaultCrioSocketFilePath,
+			Destination: &worker.CrioSocket,
+			EnvVars:     []string{"CRIO_SOCKET"},
+		},
+		&cli.DurationFlag{
+			Name:        "runtime-ready-timeout",
+			Usage:       "Time to wait for the runtime to report the kata runtime handlers after a restart",
+			Value:       2 * time.Minute,
+			Destination: &worker.RuntimeReadyTimeout,
+			EnvVars:     []string{"RUNTIME_READY_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "restart-strategy",
+			Usage:       "Strategy used to restart the runtime: signal, systemd-restart, systemd-reload, command or none. Defaults to signal for containerd and systemd-restart for CRI-O",
+			Destination: &worker.RestartStrategy,
+			EnvVars:     []string{"RESTART_STRATEGY"},
+		},
+		&cli.StringFlag{
+			Name:        "restart-unit",
+			Usage:       "systemd unit of the runtime for the systemd restart strategies. Defaults to containerd.service or crio.service",
+			Destination: &worker.RestartUnit,
+			EnvVars:     []string{"RESTART_UNIT"},
+		},
+		&cli.StringFlag{
+			Name:        "restart-command",
+			Usage:       "Shell command run on the host for the command restart strategy",
+			Destination: &worker.RestartCommand,
+			EnvVars:     []string{"RESTART_COMMAND"},
+		},
+		&cli.DurationFlag{
+			Name:        "reconcile-interval",
+			Usage:       "Interval at which artifacts, runtime config and CDI spec are checked and repaired. Periodic reconciles are disabled if zero",
+			Value:       5 * time.Minute,
+			Destination: &worker.ReconcileInterval,
+			EnvVars:     []string{"RECONCILE_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:        "watch-runtime-config",
+			Usage:       "Watch the runtime config file and drop-in directory, and re-apply the kata runtimes when another tool removes or alters them",
+			Value:       true,
+			Destination: &worker.WatchRuntimeConfig,
+			EnvVars:     []string{"WATCH_RUNTIME_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:        "cleanup-policy",
+			Usage:       "When to remove the kata runtimes from the runtime config on termination: on-uninstall, always or never. With on-uninstall, the config is only removed if the node opts out, the DaemonSet is deleted or an uninstall is requested",
+			Value:       manager.CleanupOnUninstall,
+			Destination: &worker.CleanupPolicy,
+			EnvVars:     []string{"CLEANUP_POLICY"},
+		},
+		&cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Print the changes that would be made to the host as a unified diff and a plan, without modifying the host or restarting the runtime",
+			Destination: &worker.DryRun,
+			EnvVars:     []string{"DRY_RUN"},
+		},
+		&cli.StringFlag{
+			Name:        "plan-file",
+			Usage:       "Path to write the plan of a dry run to in JSON format. If unset, the plan is printed after the diff",
+			Destination: &worker.PlanFile,
+			EnvVars:     []string{"PLAN_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "metrics-bind-address",
+			Usage:       "Address to serve Prometheus metrics on /metrics and the reconcile status on /status, e.g. :8080. Nothing is served if unset",
+			Destination: &worker.MetricsBindAddress,
+			EnvVars:     []string{"METRICS_BIND_ADDRESS"},
 		},
 	}
 
@@ -219,7 +323,10 @@ func (w *worker) Run(c *cli.Context) error {
 		klog.Info("Exiting")
 	}()
 
-	ctx := c.Context
+	// Signal handling is centralized here: a signal cancels the context, which aborts
+	// an installation in progress, or starts the cleanup once installed.
+	ctx, stop := signal.NotifyContext(c.Context, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGPIPE, syscall.SIGTERM)
+	defer stop()
 
 	klog.Infof("K8s-kata-manager Worker %s", version.Get())
 	klog.Infof("NodeName: '%s'", k8sclient.NodeName())
@@ -236,286 +343,222 @@ func (w *worker) Run(c *cli.Context) error {
 	}
 	klog.Infof("Running with configuration:\n%v", string(configYAML))
 
-	if w.Config.ArtifactsDir != api.DefaultKataArtifactsDir {
-		pidFile = filepath.Join(w.Config.ArtifactsDir, "k8s-kata-manager.pid")
+	k8scli, err := k8sclient.NewClient(w.Namespace)
+	if err != nil {
+		return fmt.Errorf("unable to create kubernetes client: %w", err)
 	}
+	defer k8scli.Shutdown()
 
-	// TODO move to subcommand or internal.pkg
-	k8scli := k8sclient.NewClient(w.Namespace)
-
-	if err := initialize(); err != nil {
-		return fmt.Errorf("unable to initialize: %w", err)
+	if err := w.detectRuntime(ctx, k8scli.GetContainerRuntimeVersion); err != nil {
+		return err
 	}
-	defer shutdown()
 
-	if w.LoadKernelModules {
-		klog.Info("Loading kernel modules required for kata workloads")
-		err = loadKernelModules()
-		if err != nil {
-			return fmt.Errorf("failed to load kernel modules: %w", err)
-		}
+	m, err := w.newManager(k8scli, k8scli)
+	if err != nil {
+		return err
 	}
 
-	if w.CDIEnabled {
-		err = generateCDISpec()
-		if err != nil {
-			return fmt.Errorf("failed to generate CDI spec: %w", err)
-		}
+	if w.DryRun {
+		return w.dryRun(ctx, m)
 	}
-	runtimeConfig, err := w.getRuntimeConfig()
-	if err != nil {
-		klog.Errorf("error creating runtime config client : %s", err)
-		return err
+
+	klog.Infof("Initializing")
+	if err := m.Lock(); err != nil {
+		return fmt.Errorf("unable to initialize: %w", err)
 	}
+	defer func() {
+		klog.Infof("Shutting Down")
+		m.Unlock()
+	}()
 
-	for _, rc := range w.Config.RuntimeClasses {
-		creds, err := k8scli.GetCredentials(ctx, rc)
-		if err != nil {
-			klog.Errorf("error getting credentials: %s", err)
-			return err
-		}
-		rcDir := filepath.Join(w.Config.ArtifactsDir, rc.Name)
-		if _, err := os.Stat(rcDir); os.IsNotExist(err) {
-			err := os.Mkdir(rcDir, 0755)
-			if err != nil {
-				klog.Errorf("error creating artifact directory: %s", err)
-				return err
-			}
-		}
-		a, err := oras.NewArtifact(rc.Artifacts.URL, rcDir)
-		if err != nil {
-			klog.Errorf("error creating artifact: %s", err)
-			return err
-		}
-		_, err = a.Pull(ctx, creds)
+	if w.MetricsBindAddress != "" {
+		stopServer, err := serveStatus(w.MetricsBindAddress, m.Status())
 		if err != nil {
-			klog.Errorf("error pulling artifact: %s", err)
 			return err
 		}
+		defer stopServer()
+	}
 
-		kataConfigCandidates, err := filepath.Glob(filepath.Join(rcDir, "*.toml"))
-		if err != nil {
-			return fmt.Errorf("error searching for kata config file: %w", err)
-		}
-		if len(kataConfigCandidates) == 0 {
-			return fmt.Errorf("no kata config file found for runtime class %s", rc.Name)
+	// A reconcile can also be requested by sending SIGUSR1 to the daemon
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-usr1:
+				m.RequestReconcile("SIGUSR1")
+			}
 		}
-		kataConfigPath := kataConfigCandidates[0]
+	}()
 
-		err = transformKataConfig(kataConfigPath)
-		if err != nil {
-			return fmt.Errorf("error transforming kata configuration file: %w", err)
-		}
+	return m.Run(ctx)
+}
 
-		err = runtimeConfig.AddRuntime(
-			rc.Name,
-			kataConfigPath,
-			false,
+// newManager returns the manager of the runtime classes on the node
+func (w *worker) newManager(cluster manager.Cluster, credentials manager.CredentialsGetter) (*manager.Manager, error) {
+	opts := []manager.Option{
+		manager.WithRuntime(w.getRuntimeConfig),
+		manager.WithCredentials(credentials),
+		manager.WithCluster(cluster),
+		manager.WithHostRoot(w.HostRoot),
+		manager.WithHostExecutor(w.hostExecutor()),
+		manager.WithHandlerVerifier(manager.NewCRIVerifier(w.runtimeSocket(), w.RuntimeReadyTimeout)),
+		manager.WithCleanupPolicy(w.CleanupPolicy),
+		manager.WithReconcileInterval(w.ReconcileInterval),
+		manager.WithLoadKernelModules(w.LoadKernelModules),
+	}
+	if w.CDIEnabled {
+		cdilib, err := cdi.New(
+			cdi.WithVendor("nvidia.com"),
+			cdi.WithClass("pgpu"),
+			cdi.WithNvpciLib(nvpci.New(nvpci.WithPCIDevicesRoot(w.hostPath(nvpci.PCIDevicesRoot)))),
 		)
 		if err != nil {
-			return fmt.Errorf("unable to update config: %w", err)
+			return nil, fmt.Errorf("unable to create cdi lib: %w", err)
 		}
-
+		opts = append(opts, manager.WithCDI(cdilib))
 	}
-	n, err := runtimeConfig.Save()
-	if err != nil {
-		return fmt.Errorf("unable to flush config: %w", err)
-	}
-	if n == 0 {
-		klog.Infof("Removed empty config")
-	} else {
-		klog.Infof("Wrote updated config")
-	}
-
-	klog.Infof("Restarting runtime")
-	if err := runtimeConfig.Restart(); err != nil {
-		return fmt.Errorf("unable to restart runtime service: %w", err)
-	}
-	klog.Info("runtime successfully restarted")
-
-	if err := waitForSignal(); err != nil {
-		return fmt.Errorf("unable to wait for signal: %w", err)
+	if w.WatchRuntimeConfig {
+		opts = append(opts, manager.WithWatchedPaths(w.watchedPaths()))
 	}
+	return manager.New(w.Config, opts...)
+}
 
-	if err := w.CleanUp(); err != nil {
-		return fmt.Errorf("unable to revert config: %w", err)
+// watchedPaths returns the runtime config files and drop-in directories watched for
+// changes made by other tools
+func (w *worker) watchedPaths() ([]string, []string) {
+	switch api.Runtime(w.Runtime) {
+	case api.CRIO:
+		return nil, []string{filepath.Dir(w.hostPath(w.CrioDropIn))}
+	case api.Containerd:
+		if w.ContainerdDropIn != "" {
+			return []string{w.hostPath(w.ContainerdConfig)}, []string{filepath.Dir(w.hostPath(w.ContainerdDropIn))}
+		}
+		return []string{w.hostPath(w.ContainerdConfig)}, nil
 	}
+	return nil, nil
+}
 
-	return nil
+// hostExecutor returns the executor of operations on the host
+func (w *worker) hostExecutor() host.Executor {
+	return host.NewExecutor(host.Root(w.HostRoot))
 }
 
-func (w *worker) getRuntimeConfig() (runtime.Runtime, error) {
-	var runtimeConfig runtime.Runtime
-	var err error
-	if w.Runtime == api.CRIO.String() {
-		options := runtime.Options{Path: w.CrioConfig, RuntimeType: "vm", PodAnnotations: []string{"io.katacontainers.*"}}
-		runtimeConfig, err = crio.Setup(&options)
-	} else if w.Runtime == api.Containerd.String() {
-		options := runtime.Options{Path: w.ContainerdConfig, RuntimeType: "io.containerd.kata.v2", PodAnnotations: []string{"io.katacontainers.*"}, Socket: w.ContainerdSocket}
-		runtimeConfig, err = containerd.Setup(&options)
-	}
-	if err != nil {
-		klog.Errorf("error creating runtime config client : %s", err)
-		return nil, err
+// hostPath returns the local path of a path on the host; unset paths stay unset
+func (w *worker) hostPath(path string) string {
+	if path == "" {
+		return ""
 	}
-	return runtimeConfig, nil
+	return host.Root(w.HostRoot).Path(path)
 }
 
-// CleanUp reverts the runtime config added by kata manager
-func (w *worker) CleanUp() error {
-	runtimeConfig, err := w.getRuntimeConfig()
-	if err != nil {
-		klog.Errorf("error creating runtime config client : %s", err)
-		return err
-	}
-	for _, rc := range w.Config.RuntimeClasses {
-		err := runtimeConfig.RemoveRuntime(rc.Name)
+// detectRuntime sets the container runtime to configure unless it was set explicitly
+func (w *worker) detectRuntime(ctx context.Context, getNodeRuntimeVersion func(context.Context) (string, error)) error {
+	if w.Runtime != "" {
+		r, err := runtime.Parse(w.Runtime)
 		if err != nil {
-			return fmt.Errorf("unable to revert config for runtime class '%v': %w", rc, err)
+			return err
 		}
+		w.Runtime = r.String()
+		return nil
 	}
-	n, err := runtimeConfig.Save()
-	if err != nil {
-		return fmt.Errorf("unable to flush config: %w", err)
-	}
-
-	if n == 0 {
-		klog.Infof("Removed empty config from %v", w.ContainerdConfig)
-	} else {
-		klog.Infof("Wrote updated config to %v", w.ContainerdConfig)
-	}
-	if err := runtimeConfig.Restart(); err != nil {
-		return fmt.Errorf("unable to restart runtime service: %w", err)
-	}
-	return nil
-}
 
-func initialize() error {
-	klog.Infof("Initializing")
-
-	f, err := os.Create(pidFile)
+	nodeRuntimeVersion, err := getNodeRuntimeVersion(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to create pidfile: %w", err)
+		klog.Warningf("Unable to get the container runtime from the node status, probing the host: %v", err)
 	}
-
-	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	r, err := runtime.Detect(nodeRuntimeVersion, w.HostRoot)
 	if err != nil {
-		klog.Warningf("Unable to get exclusive lock on '%v'", pidFile)
-		klog.Warningf("This normally means an instance of the NVIDIA k8s-kata-manager Container is already running, aborting")
-		return fmt.Errorf("unable to get flock on pidfile: %w", err)
-	}
-
-	_, err = fmt.Fprintf(f, "%v\n", os.Getpid())
-	if err != nil {
-		return fmt.Errorf("unable to write PID to pidfile: %w", err)
+		return err
 	}
-
+	klog.Infof("Detected container runtime %v", r)
+	w.Runtime = r.String()
 	return nil
 }
 
-func transformKataConfig(path string) error {
-	config, err := toml.LoadFile(path)
-	if err != nil {
-		return fmt.Errorf("error reading TOML file: %w", err)
-	}
-
-	artifactsRoot := filepath.Dir(path)
-	t := transform.NewArtifactsRootTransformer(artifactsRoot)
-	err = t.Transform(config)
-	if err != nil {
-		return fmt.Errorf("error transforming root paths in kata configuration file: %w", err)
-	}
-
-	output, err := config.ToTomlString()
+func (w *worker) getRuntimeConfig() (runtime.Runtime, error) {
+	var runtimeConfig runtime.Runtime
+	var err error
+	restarter, err := w.restartStrategy()
 	if err != nil {
-		return fmt.Errorf("unable to convert to TOML: %w", err)
-	}
-
-	if len(output) == 0 {
-		return fmt.Errorf("empty kata configuration")
+		return nil, err
 	}
-
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("unable to open '%s' for writing: %w", path, err)
+	switch api.Runtime(w.Runtime) {
+	case api.CRIO:
+		options := runtime.Options{Path: w.hostPath(w.CrioDropIn), RuntimeType: "vm", PodAnnotations: []string{"io.katacontainers.*"}, Socket: w.hostPath(w.CrioSocket)}
+		options.BackupDir = w.hostPath(manager.BackupDir(w.Config.ArtifactsDir))
+		options.HostRoot = w.HostRoot
+		options.Executor = w.hostExecutor()
+		options.Restarter = restarter
+		runtimeConfig, err = crio.Setup(&options)
+	case api.Containerd:
+		options := runtime.Options{Path: w.hostPath(w.ContainerdConfig), DropInPath: w.hostPath(w.ContainerdDropIn), RuntimeType: "io.containerd.kata.v2", PodAnnotations: []string{"io.katacontainers.*"}, Socket: w.hostPath(w.ContainerdSocket)}
+		options.BackupDir = w.hostPath(manager.BackupDir(w.Config.ArtifactsDir))
+		options.HostRoot = w.HostRoot
+		options.Restarter = restarter
+		runtimeConfig, err = containerd.Setup(&options)
+	default:
+		err = fmt.Errorf("unsupported container runtime %q", w.Runtime)
 	}
-	defer f.Close()
-
-	_, err = f.WriteString(output)
 	if err != nil {
-		return fmt.Errorf("unable to write output: %w", err)
+		klog.Errorf("error creating runtime config client : %s", err)
+		return nil, err
 	}
-
-	return nil
+	return runtimeConfig, nil
 }
 
-func loadKernelModules() error {
-	var err error
-	modules := []string{"vhost-vsock", "vhost-net"}
-	for _, module := range modules {
-		klog.Infof("Loading kernel module %s", module)
-		args := []string{"/host", "modprobe", module}
-		err = exec.Command("chroot", args...).Run()
-		if err != nil {
-			return fmt.Errorf("failed to load module %s: %w", module, err)
+// restartStrategy returns the strategy used to restart the runtime
+func (w *worker) restartStrategy() (restart.Strategy, error) {
+	options := restart.Options{
+		Strategy: w.RestartStrategy,
+		Socket:   w.runtimeSocket(),
+		Unit:     w.RestartUnit,
+		Command:  w.RestartCommand,
+		HostRoot: w.HostRoot,
+		Executor: w.hostExecutor(),
+		Timeout:  w.RuntimeReadyTimeout,
+	}
+	if options.Strategy == "" {
+		options.Strategy = restart.Signal
+		if api.Runtime(w.Runtime) == api.CRIO {
+			options.Strategy = restart.SystemdRestart
 		}
 	}
-	return nil
-}
-
-func generateCDISpec() error {
-	klog.Info("Generating a CDI specification for all NVIDIA GPUs configured for passthrough")
-	cdilib, err := cdi.New(
-		cdi.WithVendor("nvidia.com"),
-		cdi.WithClass("pgpu"),
-	)
-	if err != nil {
-		return fmt.Errorf("unabled to create cdi lib: %w", err)
-	}
-
-	spec, err := cdilib.GetSpec()
-	if err != nil {
-		return fmt.Errorf("error getting cdi spec: %w", err)
+	if options.Unit == "" {
+		options.Unit = w.Runtime + ".service"
 	}
+	return restart.New(options)
+}
 
-	specName, err := cdiapi.GenerateNameForSpec(spec.Raw())
-	if err != nil {
-		return fmt.Errorf("failed to generate cdi spec name: %w", err)
+// runtimeSocket returns the local path of the CRI socket of the runtime
+func (w *worker) runtimeSocket() string {
+	if api.Runtime(w.Runtime) == api.CRIO {
+		return w.hostPath(w.CrioSocket)
 	}
+	return w.hostPath(w.ContainerdSocket)
+}
 
-	err = spec.Save(filepath.Join(cdiRoot, specName+".yaml"))
+// serveStatus serves the metrics and the reconcile status on the address until the
+// returned function is called
+func serveStatus(address string, status http.Handler) (func(), error) {
+	l, err := net.Listen("tcp", address)
 	if err != nil {
-		return fmt.Errorf("failed to save cdi spec: %w", err)
+		return nil, fmt.Errorf("unable to listen on %v for metrics: %w", address, err)
 	}
 
-	return nil
-}
-
-func waitForSignal() error {
-	klog.Infof("Waiting for signal")
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGPIPE, syscall.SIGTERM)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/status", status)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
 	go func() {
-		<-sigs
-		select {
-		case <-waitingForSignal:
-			signalReceived <- true
-		default:
-			klog.Infof("Signal received, exiting early")
-			shutdown()
-			os.Exit(0)
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("Error serving metrics: %v", err)
 		}
 	}()
+	klog.Infof("Serving metrics on %v", l.Addr())
 
-	waitingForSignal <- true
-	<-signalReceived
-	return nil
-}
-
-func shutdown() {
-	klog.Infof("Shutting Down")
-
-	if err := os.Remove(pidFile); err != nil {
-		klog.Warningf("Unable to remove pidfile: %v", err)
-	}
+	return func() { _ = server.Close() }, nil
 }
@@ -78,9 +78,9 @@ func (m command) run(c *cli.Context) error {
 	containerdSocketFilePath := c.Args().Get(0)
 	var err error
 	if containerdSocketFilePath == "" {
-		err = containerd.RestartContainerd(defaultContainerdSocketFilePath)
+		err = containerd.RestartContainerd(c.Context, defaultContainerdSocketFilePath)
 	} else {
-		err = containerd.RestartContainerd(containerdSocketFilePath)
+		err = containerd.RestartContainerd(c.Context, containerdSocketFilePath)
 	}
 	if err != nil {
 		m.logger.Errorf("failed to restart containerd: %v", err)
@@ -24,6 +24,7 @@ import (
 
 	"github.com/NVIDIA/k8s-kata-manager/cmd/kata-manager/containerd"
 	"github.com/NVIDIA/k8s-kata-manager/cmd/kata-manager/pull"
+	"github.com/NVIDIA/k8s-kata-manager/cmd/kata-manager/runtime"
 )
 
 var logger = log.New()
@@ -66,6 +67,7 @@ func main() {
 	c.Commands = []*cli.Command{
 		pull.NewCommand(logger),
 		containerd.NewCommand(logger),
+		runtime.NewCommand(logger),
 	}
 
 	err := c.Run(os.Args)
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+)
+
+type restoreCommand struct {
+	logger *logrus.Logger
+}
+
+type restoreOptions struct {
+	backupDir string
+	hostRoot  string
+}
+
+// newRestoreCommand constructs a restore command with the specified logger
+func newRestoreCommand(logger *logrus.Logger) *cli.Command {
+	c := restoreCommand{
+		logger: logger,
+	}
+	return c.build()
+}
+
+// build creates the CLI command
+func (m restoreCommand) build() *cli.Command {
+	opts := restoreOptions{}
+
+	// Create the 'restore' command
+	c := cli.Command{
+		Name:  "restore",
+		Usage: "Restore runtime config files to their content before kata manager first modified them",
+		UsageText: "kata-manager runtime restore [flags] [<config-path>...]\n\n" +
+			"Restores all backed up config files unless config paths are specified.\n" +
+			"The container runtime has to be restarted for the restored config to apply.",
+		Action: func(c *cli.Context) error {
+			return m.run(c, &opts)
+		},
+	}
+
+	c.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "backup-dir",
+			Usage:       "Directory holding the backups of the original runtime config files",
+			Value:       filepath.Join(api.DefaultKataArtifactsDir, backup.DirName),
+			Destination: &opts.backupDir,
+			EnvVars:     []string{"BACKUP_DIR"},
+		},
+		&cli.StringFlag{
+			Name:        "host-root",
+			Usage:       "Path the host root filesystem is mounted at. The backup directory and config paths are resolved against it",
+			Value:       "/",
+			Destination: &opts.hostRoot,
+			EnvVars:     []string{"HOST_ROOT"},
+		},
+	}
+
+	return &c
+}
+
+func (m restoreCommand) run(c *cli.Context, opts *restoreOptions) error {
+	root := host.Root(opts.hostRoot)
+	backupDir := root.Path(opts.backupDir)
+	if c.Args().Len() > 0 {
+		var paths []string
+		for _, path := range c.Args().Slice() {
+			paths = append(paths, root.Path(path))
+		}
+		if err := backup.RestoreFiles(backupDir, root, paths...); err != nil {
+			return fmt.Errorf("failed to restore runtime config: %w", err)
+		}
+		for _, path := range c.Args().Slice() {
+			if err := discardRecords(backupDir, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	backups, err := backup.List(backupDir)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	if len(backups) == 0 {
+		m.logger.Infof("No backups found in %v", backupDir)
+		return nil
+	}
+	for _, b := range backups {
+		if err := b.Restore(root); err != nil {
+			return fmt.Errorf("failed to restore runtime config: %w", err)
+		}
+		m.logger.Infof("Restored %v as of %v", b.Path, b.Created)
+		if err := discardRecords(backupDir, b.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardRecords discards the keys kata manager tracks in a restored config file,
+// as the file no longer holds any kata manager settings
+func discardRecords(dir string, path string) error {
+	records, err := ownership.Load(dir, path)
+	if err != nil {
+		return err
+	}
+	if err := records.Discard(); err != nil {
+		return fmt.Errorf("failed to discard ownership records of %v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// hostFeatureCheck reports whether a host feature is available under the specified root
+type hostFeatureCheck func(root string) bool
+
+var hostFeatureChecks = map[string]hostFeatureCheck{
+	"kvm":         pathExists("dev/kvm"),
+	"vhost-vsock": pathExists("dev/vhost-vsock"),
+	"vhost-net":   pathExists("dev/vhost-net"),
+	"vfio":        pathExists("dev/vfio/vfio"),
+	"iommu":       dirNotEmpty("sys/kernel/iommu_groups"),
+	"sev":         moduleParamEnabled("kvm_amd", "sev"),
+	"sev-snp":     moduleParamEnabled("kvm_amd", "sev_snp"),
+	"tdx":         moduleParamEnabled("kvm_intel", "tdx"),
+}
+
+// CheckHostFeatures returns an error listing the features which are not available
+// on the host mounted at root. Features unknown to this version of the manager are
+// logged and ignored.
+func CheckHostFeatures(root string, features []string) error {
+	var missing []string
+	for _, feature := range features {
+		check, ok := hostFeatureChecks[feature]
+		if !ok {
+			klog.Warningf("Unknown host feature %q, skipping check", feature)
+			continue
+		}
+		if !check(root) {
+			missing = append(missing, feature)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required host features not available: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func pathExists(path string) hostFeatureCheck {
+	return func(root string) bool {
+		_, err := os.Stat(filepath.Join(root, path))
+		return err == nil
+	}
+}
+
+func dirNotEmpty(path string) hostFeatureCheck {
+	return func(root string) bool {
+		entries, err := os.ReadDir(filepath.Join(root, path))
+		return err == nil && len(entries) > 0
+	}
+}
+
+func moduleParamEnabled(module string, param string) hostFeatureCheck {
+	return func(root string) bool {
+		data, err := os.ReadFile(filepath.Join(root, "sys/module", module, "parameters", param))
+		if err != nil {
+			return false
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "Y", "y", "1":
+			return true
+		}
+		return false
+	}
+}
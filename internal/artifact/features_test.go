@@ -0,0 +1,40 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHostFeatures(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dev"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dev/kvm"), nil, 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys/module/kvm_amd/parameters"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sys/module/kvm_amd/parameters/sev_snp"), []byte("Y\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sys/module/kvm_amd/parameters/sev"), []byte("N\n"), 0600))
+
+	require.NoError(t, CheckHostFeatures(root, nil))
+	require.NoError(t, CheckHostFeatures(root, []string{"kvm", "sev-snp", "unknown-feature"}))
+
+	err := CheckHostFeatures(root, []string{"kvm", "sev", "tdx"})
+	require.EqualError(t, err, "required host features not available: sev, tdx")
+}
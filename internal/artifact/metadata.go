@@ -0,0 +1,129 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+)
+
+// Metadata holds the settings advertised by a kata artifact through the
+// well-known annotations of its manifest
+type Metadata struct {
+	KataConfig           string
+	RuntimeType          string
+	Overhead             corev1.ResourceList
+	RequiredHostFeatures []string
+	MinManagerVersion    string
+}
+
+// NewMetadata parses the well-known kata annotations of an artifact manifest.
+// Unknown annotations are ignored.
+func NewMetadata(annotations map[string]string) (*Metadata, error) {
+	m := &Metadata{
+		KataConfig:  annotations[api.AnnotationKataConfig],
+		RuntimeType: annotations[api.AnnotationRuntimeType],
+	}
+
+	if m.KataConfig != "" && strings.ContainsRune(m.KataConfig, '/') {
+		return nil, fmt.Errorf("invalid %s annotation %q: must be a file name", api.AnnotationKataConfig, m.KataConfig)
+	}
+
+	overheads := map[corev1.ResourceName]string{
+		corev1.ResourceCPU:    api.AnnotationOverheadCPU,
+		corev1.ResourceMemory: api.AnnotationOverheadMemory,
+	}
+	for name, key := range overheads {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation %q: %w", key, value, err)
+		}
+		if m.Overhead == nil {
+			m.Overhead = corev1.ResourceList{}
+		}
+		m.Overhead[name] = q
+	}
+
+	for _, feature := range strings.Split(annotations[api.AnnotationRequiredHostFeatures], ",") {
+		feature = strings.TrimSpace(feature)
+		if feature == "" {
+			continue
+		}
+		m.RequiredHostFeatures = append(m.RequiredHostFeatures, feature)
+	}
+
+	if v, ok := annotations[api.AnnotationMinManagerVersion]; ok {
+		m.MinManagerVersion = canonicalVersion(v)
+		if !semver.IsValid(m.MinManagerVersion) {
+			return nil, fmt.Errorf("invalid %s annotation %q: not a semantic version", api.AnnotationMinManagerVersion, v)
+		}
+	}
+
+	return m, nil
+}
+
+// ApplyDefaults sets the settings of the runtime class which were not explicitly
+// configured to the values advertised by the artifact
+func (m *Metadata) ApplyDefaults(rc *api.RuntimeClass) {
+	if rc.KataConfig == "" {
+		rc.KataConfig = m.KataConfig
+	}
+	if rc.RuntimeType == "" {
+		rc.RuntimeType = m.RuntimeType
+	}
+	if rc.Overhead == nil && len(m.Overhead) > 0 {
+		rc.Overhead = &api.Overhead{PodFixed: m.Overhead.DeepCopy()}
+	}
+}
+
+// CheckManagerVersion returns an error if the specified manager version is older than
+// the minimum version required by the artifact. Development builds without a valid
+// version are not checked.
+func (m *Metadata) CheckManagerVersion(current string) error {
+	if m.MinManagerVersion == "" {
+		return nil
+	}
+	v := canonicalVersion(current)
+	if !semver.IsValid(v) {
+		klog.Warningf("Unable to compare manager version %q with required minimum version %s, skipping check", current, m.MinManagerVersion)
+		return nil
+	}
+	if semver.Compare(v, m.MinManagerVersion) < 0 {
+		return fmt.Errorf("artifact requires kata manager version %s or later, running %s", m.MinManagerVersion, v)
+	}
+	return nil
+}
+
+// canonicalVersion adds the 'v' prefix expected by the semver package if missing
+func canonicalVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.HasPrefix(v, "v") {
+		return v
+	}
+	return "v" + v
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+)
+
+func TestNewMetadata(t *testing.T) {
+	testCases := []struct {
+		description      string
+		annotations      map[string]string
+		expectedMetadata *Metadata
+		expectedError    bool
+	}{
+		{
+			description:      "no annotations",
+			annotations:      nil,
+			expectedMetadata: &Metadata{},
+		},
+		{
+			description: "all annotations",
+			annotations: map[string]string{
+				api.AnnotationKataConfig:           "configuration-kata-qemu-nvidia-gpu-snp.toml",
+				api.AnnotationRuntimeType:          "io.containerd.kata-qemu-snp.v2",
+				api.AnnotationOverheadCPU:          "250m",
+				api.AnnotationOverheadMemory:       "160Mi",
+				api.AnnotationRequiredHostFeatures: "kvm, sev-snp,,vfio",
+				api.AnnotationMinManagerVersion:    "0.2.3",
+				"org.opencontainers.image.created": "2024-01-01T00:00:00Z",
+			},
+			expectedMetadata: &Metadata{
+				KataConfig:  "configuration-kata-qemu-nvidia-gpu-snp.toml",
+				RuntimeType: "io.containerd.kata-qemu-snp.v2",
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("160Mi"),
+				},
+				RequiredHostFeatures: []string{"kvm", "sev-snp", "vfio"},
+				MinManagerVersion:    "v0.2.3",
+			},
+		},
+		{
+			description: "kata config is a path",
+			annotations: map[string]string{
+				api.AnnotationKataConfig: "../configuration.toml",
+			},
+			expectedError: true,
+		},
+		{
+			description: "invalid overhead",
+			annotations: map[string]string{
+				api.AnnotationOverheadMemory: "lots",
+			},
+			expectedError: true,
+		},
+		{
+			description: "invalid minimum version",
+			annotations: map[string]string{
+				api.AnnotationMinManagerVersion: "latest",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			m, err := NewMetadata(tc.annotations)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedMetadata, m)
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	m := &Metadata{
+		KataConfig:  "configuration-kata-qemu.toml",
+		RuntimeType: "io.containerd.kata-qemu.v2",
+		Overhead: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("160Mi"),
+		},
+	}
+
+	rc := &api.RuntimeClass{
+		Name:        "kata-qemu-nvidia-gpu",
+		RuntimeType: "io.containerd.kata.v2",
+	}
+	m.ApplyDefaults(rc)
+
+	require.Equal(t, "configuration-kata-qemu.toml", rc.KataConfig)
+	require.Equal(t, "io.containerd.kata.v2", rc.RuntimeType)
+	require.Equal(t, m.Overhead, rc.Overhead.PodFixed)
+}
+
+func TestCheckManagerVersion(t *testing.T) {
+	testCases := []struct {
+		description   string
+		minVersion    string
+		current       string
+		expectedError bool
+	}{
+		{
+			description: "no minimum version",
+			current:     "v0.1.0",
+		},
+		{
+			description: "newer manager",
+			minVersion:  "v0.2.0",
+			current:     "v0.2.3",
+		},
+		{
+			description:   "older manager",
+			minVersion:    "v0.3.0",
+			current:       "0.2.3",
+			expectedError: true,
+		},
+		{
+			description: "undefined manager version",
+			minVersion:  "v0.3.0",
+			current:     "undefined",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			m := &Metadata{MinManagerVersion: tc.minVersion}
+			err := m.CheckManagerVersion(tc.current)
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
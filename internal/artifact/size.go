@@ -0,0 +1,98 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+)
+
+// InsufficientSpaceError is returned when the filesystem holding the artifacts
+// does not have enough free space to pull an artifact
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient disk space on the filesystem of %s: %s required, %s available",
+		e.Path, formatBytes(e.Required), formatBytes(e.Available))
+}
+
+// PayloadSize returns the total size of the layers of an artifact
+func PayloadSize(manifest *ocispec.Manifest) int64 {
+	var size int64
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// RequiredSpace returns the disk space needed to pull the layers of an artifact
+// which are not already present in the blob cache
+func RequiredSpace(manifest *ocispec.Manifest, c *cache.Cache) int64 {
+	var size int64
+	for _, layer := range manifest.Layers {
+		if c != nil && c.Has(layer) {
+			continue
+		}
+		size += layer.Size
+	}
+	return size
+}
+
+// CheckMaxSize returns an error if the payload size exceeds the maximum size.
+// A nil maximum size does not enforce any limit.
+func CheckMaxSize(size int64, maxSize *resource.Quantity) error {
+	if maxSize == nil {
+		return nil
+	}
+	if size > maxSize.Value() {
+		return fmt.Errorf("artifact size of %s exceeds the maximum artifact size of %s",
+			formatBytes(size), formatBytes(maxSize.Value()))
+	}
+	return nil
+}
+
+// CheckFreeSpace returns an InsufficientSpaceError if the filesystem holding path
+// has less than the required number of bytes available
+func CheckFreeSpace(path string, required int64) error {
+	if required <= 0 {
+		return nil
+	}
+	available, err := freeSpace(path)
+	if err != nil {
+		return fmt.Errorf("unable to determine free disk space: %w", err)
+	}
+	if required > available {
+		return &InsufficientSpaceError{
+			Path:      path,
+			Required:  required,
+			Available: available,
+		}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%d bytes (%s)", n, resource.NewQuantity(n, resource.BinarySI).String())
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+)
+
+func TestRequiredSpace(t *testing.T) {
+	kernel := []byte("vmlinuz")
+	kernelDesc := ocispec.Descriptor{Digest: digest.FromBytes(kernel), Size: int64(len(kernel))}
+	manifest := &ocispec.Manifest{
+		Layers: []ocispec.Descriptor{
+			kernelDesc,
+			{Digest: digest.FromString("rootfs"), Size: 1 << 30},
+		},
+	}
+
+	c, err := cache.New(filepath.Join(t.TempDir(), cache.DirName))
+	require.NoError(t, err)
+
+	require.Equal(t, int64(len(kernel))+1<<30, PayloadSize(manifest))
+	require.Equal(t, int64(len(kernel))+1<<30, RequiredSpace(manifest, c))
+
+	require.NoError(t, c.Ingest(kernelDesc, bytes.NewReader(kernel)))
+	require.Equal(t, int64(1<<30), RequiredSpace(manifest, c))
+}
+
+func TestCheckMaxSize(t *testing.T) {
+	maxSize := resource.MustParse("1Gi")
+
+	require.NoError(t, CheckMaxSize(1<<40, nil))
+	require.NoError(t, CheckMaxSize(1<<30, &maxSize))
+	require.EqualError(t, CheckMaxSize(2<<30, &maxSize),
+		"artifact size of 2147483648 bytes (2Gi) exceeds the maximum artifact size of 1073741824 bytes (1Gi)")
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, CheckFreeSpace(dir, 0))
+	require.NoError(t, CheckFreeSpace(dir, 1))
+
+	err := CheckFreeSpace(dir, 1<<62)
+	var spaceErr *InsufficientSpaceError
+	require.True(t, errors.As(err, &spaceErr))
+	require.Equal(t, int64(1<<62), spaceErr.Required)
+	require.Less(t, spaceErr.Available, spaceErr.Required)
+}
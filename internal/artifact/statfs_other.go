@@ -16,11 +16,11 @@
 # limitations under the License.
 **/
 
-package containerd
+package artifact
 
 import "fmt"
 
-// RestartContainerd is not supported on non-linux platforms.
-func RestartContainerd(string) error {
-	return fmt.Errorf("RestartContainerd is not supported on non-linux platforms")
+// freeSpace is not supported on non-linux platforms.
+func freeSpace(string) (int64, error) {
+	return 0, fmt.Errorf("free space check is not supported on non-linux platforms")
 }
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Verify checks that the artifact described by the manifest can be installed by
+// the current kata manager on the host mounted at hostRoot, and returns its metadata
+func Verify(manifest *ocispec.Manifest, managerVersion string, hostRoot string, maxSize *resource.Quantity) (*Metadata, error) {
+	metadata, err := NewMetadata(manifest.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact annotations: %w", err)
+	}
+	if err := metadata.CheckManagerVersion(managerVersion); err != nil {
+		return nil, err
+	}
+	if err := CheckHostFeatures(hostRoot, metadata.RequiredHostFeatures); err != nil {
+		return nil, err
+	}
+	if err := CheckMaxSize(PayloadSize(manifest), maxSize); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// KataConfigPath returns the path of the kata configuration file installed in dir.
+// If name is empty, the first TOML file in dir is used.
+func KataConfigPath(dir string, name string) (string, error) {
+	if name != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("kata config file %s not found: %w", name, err)
+		}
+		return path, nil
+	}
+
+	candidates, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return "", fmt.Errorf("error searching for kata config file: %w", err)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no kata config file found in %s", dir)
+	}
+	return candidates[0], nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+)
+
+func TestVerify(t *testing.T) {
+	maxSize := resource.MustParse("1Ki")
+
+	testCases := []struct {
+		description   string
+		manifest      *ocispec.Manifest
+		expectedError string
+	}{
+		{
+			description: "installable",
+			manifest: &ocispec.Manifest{
+				Annotations: map[string]string{api.AnnotationKataConfig: "configuration-kata-qemu.toml"},
+				Layers:      []ocispec.Descriptor{{Size: 512}},
+			},
+		},
+		{
+			description: "newer manager required",
+			manifest: &ocispec.Manifest{
+				Annotations: map[string]string{api.AnnotationMinManagerVersion: "v99.0.0"},
+			},
+			expectedError: "v99.0.0",
+		},
+		{
+			description: "too large",
+			manifest: &ocispec.Manifest{
+				Layers: []ocispec.Descriptor{{Size: 2048}},
+			},
+			expectedError: "exceeds",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			metadata, err := Verify(tc.manifest, "v0.3.0", t.TempDir(), &maxSize)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.manifest.Annotations[api.AnnotationKataConfig], metadata.KataConfig)
+		})
+	}
+}
+
+func TestKataConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "configuration-kata-qemu.toml"), nil, 0644))
+
+	path, err := KataConfigPath(dir, "")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "configuration-kata-qemu.toml"), path)
+
+	_, err = KataConfigPath(dir, "configuration-kata-clh.toml")
+	require.ErrorContains(t, err, "configuration-kata-clh.toml not found")
+
+	_, err = KataConfigPath(t.TempDir(), "")
+	require.ErrorContains(t, err, "no kata config file found")
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/klog/v2"
+	"oras.land/oras-go/v2/content"
+)
+
+// DirName is the name of the blob cache directory under the artifacts directory.
+// RuntimeClass names are DNS labels so they never collide with it.
+const DirName = ".blobs"
+
+// Cache is a node-local content-addressed store of artifact blobs. The per runtime
+// class artifact directories link into the cache, so blobs shared between runtime
+// classes are only fetched and stored once.
+type Cache struct {
+	root string
+}
+
+// Usage describes the disk space used by the blob cache
+type Usage struct {
+	// Blobs is the number of blobs in the cache
+	Blobs int
+	// Bytes is the total size of the blobs in the cache
+	Bytes int64
+	// UnreferencedBlobs is the number of blobs not linked into any artifact directory
+	UnreferencedBlobs int
+	// UnreferencedBytes is the total size of the unreferenced blobs
+	UnreferencedBytes int64
+}
+
+// New creates a blob cache rooted at the specified directory
+func New(root string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Join(root, "ingest"), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create blob cache: %w", err)
+	}
+	return &Cache{root: root}, nil
+}
+
+// Path returns the location of the blob with the specified digest in the cache
+func (c *Cache) Path(d digest.Digest) string {
+	return filepath.Join(c.root, "blobs", d.Algorithm().String(), d.Encoded())
+}
+
+// Has returns true if a blob matching the descriptor is present in the cache
+func (c *Cache) Has(desc ocispec.Descriptor) bool {
+	if desc.Digest.Validate() != nil {
+		return false
+	}
+	info, err := os.Stat(c.Path(desc.Digest))
+	return err == nil && info.Mode().IsRegular() && info.Size() == desc.Size
+}
+
+// Ingest writes the content read from r into the cache. The content is verified
+// against the descriptor before being committed to the cache.
+func (c *Cache) Ingest(desc ocispec.Descriptor, r io.Reader) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return fmt.Errorf("invalid digest: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.root, "ingest"), desc.Digest.Encoded())
+	if err != nil {
+		return fmt.Errorf("unable to create ingest file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	vr := content.NewVerifyReader(r, desc)
+	if _, err := io.Copy(tmp, vr); err != nil {
+		return fmt.Errorf("unable to write blob %s: %w", desc.Digest, err)
+	}
+	if err := vr.Verify(); err != nil {
+		return fmt.Errorf("unable to verify blob %s: %w", desc.Digest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write blob %s: %w", desc.Digest, err)
+	}
+
+	path := c.Path(desc.Digest)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create blob directory: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return fmt.Errorf("unable to set blob permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to commit blob %s: %w", desc.Digest, err)
+	}
+	return nil
+}
+
+// Link makes the blob with the specified digest available at dst. A hardlink is
+// used if possible, falling back to a reflink and finally to a plain copy when
+// dst is on a different filesystem than the cache.
+func (c *Cache) Link(d digest.Digest, dst string) error {
+	src := c.Path(d)
+	if linked(src, dst) {
+		return nil
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove %s: %w", dst, err)
+	}
+
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	klog.V(4).Infof("Unable to hardlink %s to %s, copying blob", d, dst)
+	return copyFile(src, dst)
+}
+
+// linked returns whether dst is a hardlink of src
+func linked(src string, dst string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	dstInfo, err := os.Lstat(dst)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(srcInfo, dstInfo)
+}
+
+// Usage returns the disk space used by the cache
+func (c *Cache) Usage() (Usage, error) {
+	var u Usage
+	err := c.walk(func(path string, info os.FileInfo) error {
+		u.Blobs++
+		u.Bytes += info.Size()
+		if linkCount(info) <= 1 {
+			u.UnreferencedBlobs++
+			u.UnreferencedBytes += info.Size()
+		}
+		return nil
+	})
+	return u, err
+}
+
+// Prune removes the blobs which are not linked into any artifact directory and
+// returns the number of bytes freed. Blobs which were copied rather than linked
+// appear unreferenced and are removed too; they are fetched again when needed.
+func (c *Cache) Prune() (int64, error) {
+	var freed int64
+	err := c.walk(func(path string, info os.FileInfo) error {
+		if linkCount(info) > 1 {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("unable to remove blob: %w", err)
+		}
+		freed += info.Size()
+		return nil
+	})
+	return freed, err
+}
+
+// walk calls fn for every blob in the cache
+func (c *Cache) walk(fn func(path string, info os.FileInfo) error) error {
+	err := filepath.Walk(filepath.Join(c.root, "blobs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(path, info)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("unable to open blob: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if err := reflink(out, in); err == nil {
+		return nil
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("unable to copy blob to %s: %w", dst, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func descriptorFor(data []byte) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+}
+
+func TestCacheIngestAndLink(t *testing.T) {
+	root := t.TempDir()
+	c, err := New(filepath.Join(root, DirName))
+	require.NoError(t, err)
+
+	kernel := []byte("vmlinuz")
+	desc := descriptorFor(kernel)
+	require.False(t, c.Has(desc))
+
+	require.Error(t, c.Ingest(desc, bytes.NewReader([]byte("tampered"))))
+	require.False(t, c.Has(desc))
+
+	require.NoError(t, c.Ingest(desc, bytes.NewReader(kernel)))
+	require.True(t, c.Has(desc))
+
+	for _, rc := range []string{"kata-qemu", "kata-qemu-snp"} {
+		dir := filepath.Join(root, rc)
+		require.NoError(t, os.Mkdir(dir, 0755))
+		require.NoError(t, c.Link(desc.Digest, filepath.Join(dir, "vmlinuz.container")))
+		// linking again replaces the existing file
+		require.NoError(t, c.Link(desc.Digest, filepath.Join(dir, "vmlinuz.container")))
+
+		data, err := os.ReadFile(filepath.Join(dir, "vmlinuz.container"))
+		require.NoError(t, err)
+		require.Equal(t, kernel, data)
+	}
+
+	usage, err := c.Usage()
+	require.NoError(t, err)
+	require.Equal(t, Usage{Blobs: 1, Bytes: int64(len(kernel))}, usage)
+}
+
+func TestCachePrune(t *testing.T) {
+	root := t.TempDir()
+	c, err := New(filepath.Join(root, DirName))
+	require.NoError(t, err)
+
+	used := []byte("rootfs")
+	unused := []byte("stale rootfs")
+	require.NoError(t, c.Ingest(descriptorFor(used), bytes.NewReader(used)))
+	require.NoError(t, c.Ingest(descriptorFor(unused), bytes.NewReader(unused)))
+	require.NoError(t, c.Link(descriptorFor(used).Digest, filepath.Join(root, "rootfs.image")))
+
+	usage, err := c.Usage()
+	require.NoError(t, err)
+	require.Equal(t, 2, usage.Blobs)
+	require.Equal(t, 1, usage.UnreferencedBlobs)
+	require.Equal(t, int64(len(unused)), usage.UnreferencedBytes)
+
+	freed, err := c.Prune()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(unused)), freed)
+	require.True(t, c.Has(descriptorFor(used)))
+	require.False(t, c.Has(descriptorFor(unused)))
+}
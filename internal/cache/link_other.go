@@ -0,0 +1,35 @@
+//go:build !linux
+
+/**
+# Copyright 2024 NVIDIA CORPORATION
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+**/
+
+package cache
+
+import (
+	"fmt"
+	"os"
+)
+
+// reflink is not supported on non-linux platforms.
+func reflink(*os.File, *os.File) error {
+	return fmt.Errorf("reflink is not supported on non-linux platforms")
+}
+
+// linkCount cannot be determined on non-linux platforms; blobs are always
+// reported as referenced so that they are never pruned.
+func linkCount(os.FileInfo) uint64 {
+	return 2
+}
@@ -17,38 +17,177 @@
 package kubernetes
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	nodeapply "k8s.io/client-go/applyconfigurations/node/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	appsclient "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	nodeclient "k8s.io/client-go/kubernetes/typed/node/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
+// component is the component recorded as the source of events and as the field
+// manager of applied objects
+const component = "k8s-kata-manager"
+
 var nodeName string
+var podName string
 
 type k8scli struct {
 	corev1.SecretInterface
 
-	namespace string
+	nodes          corev1.NodeInterface
+	pods           corev1.PodsGetter
+	daemonSets     appsclient.DaemonSetInterface
+	runtimeClasses nodeclient.RuntimeClassInterface
+	broadcaster    record.EventBroadcaster
+	recorder       record.EventRecorder
+	namespace      string
 }
 
-func NewClient(namespace string) k8scli {
+// NewClient returns a client of the cluster we're running in
+func NewClient(namespace string) (*k8scli, error) {
 	// creates the in-cluster config
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		panic(err.Error())
+		return nil, fmt.Errorf("unable to get in-cluster config: %w", err)
 	}
 	// creates the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		return nil, fmt.Errorf("unable to create clientset: %w", err)
 	}
 
-	k := k8scli{
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: clientset.CoreV1().Events(metav1.NamespaceAll)})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component, Host: NodeName()})
+
+	k := &k8scli{
 		clientset.CoreV1().Secrets(namespace),
+		clientset.CoreV1().Nodes(),
+		clientset.CoreV1(),
+		clientset.AppsV1().DaemonSets(namespace),
+		clientset.NodeV1().RuntimeClasses(),
+		broadcaster,
+		recorder,
 		namespace}
-	return k
+	return k, nil
+}
+
+// SetRuntimeClassOverhead sets the pod overhead of an existing RuntimeClass object.
+// The RuntimeClass is not created if it doesn't exist, and an overhead owned by
+// another field manager, e.g. the GPU Operator, is not taken over; a conflict error
+// is returned instead.
+func (k *k8scli) SetRuntimeClassOverhead(ctx context.Context, name string, overhead v1.ResourceList) error {
+	if _, err := k.runtimeClasses.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("error getting RuntimeClass: %w", err)
+	}
+	rc := nodeapply.RuntimeClass(name).
+		WithOverhead(nodeapply.Overhead().WithPodFixed(overhead))
+	if _, err := k.runtimeClasses.Apply(ctx, rc, metav1.ApplyOptions{FieldManager: component}); err != nil {
+		return fmt.Errorf("error applying RuntimeClass: %w", err)
+	}
+	return nil
+}
+
+// GetContainerRuntimeVersion returns the container runtime version reported in the
+// status of the node we're running on, e.g. containerd://1.7.2
+func (k *k8scli) GetContainerRuntimeVersion(ctx context.Context) (string, error) {
+	if NodeName() == "" {
+		return "", fmt.Errorf("node name is not set")
+	}
+	node, err := k.nodes.Get(ctx, NodeName(), metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting node: %w", err)
+	}
+	return node.Status.NodeInfo.ContainerRuntimeVersion, nil
+}
+
+// GetNodeLabels returns the labels of the node we're running on
+func (k *k8scli) GetNodeLabels(ctx context.Context) (map[string]string, error) {
+	if NodeName() == "" {
+		return nil, fmt.Errorf("node name is not set")
+	}
+	node, err := k.nodes.Get(ctx, NodeName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting node: %w", err)
+	}
+	return node.Labels, nil
+}
+
+// GetOwnerDaemonSet returns the DaemonSet controlling the pod we're running in, or
+// nil if the DaemonSet no longer exists
+func (k *k8scli) GetOwnerDaemonSet(ctx context.Context) (*appsv1.DaemonSet, error) {
+	if PodName() == "" {
+		return nil, fmt.Errorf("pod name is not set")
+	}
+	pod, err := k.pods.Pods(k.namespace).Get(ctx, PodName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod: %w", err)
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "DaemonSet" {
+		return nil, fmt.Errorf("pod %s is not controlled by a DaemonSet", PodName())
+	}
+	ds, err := k.daemonSets.Get(ctx, owner.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting DaemonSet: %w", err)
+	}
+	if ds.UID != owner.UID {
+		// The DaemonSet was deleted and created again under the same name
+		return nil, nil
+	}
+	return ds, nil
+}
+
+// ListNodePods returns the pods scheduled on the node we're running on in all
+// namespaces
+func (k *k8scli) ListNodePods(ctx context.Context) ([]v1.Pod, error) {
+	if NodeName() == "" {
+		return nil, fmt.Errorf("node name is not set")
+	}
+	pods, err := k.pods.Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", NodeName()).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+// RecordNodeEvent records an event about the node we're running on. Events are
+// recorded asynchronously; like the kubelet's node events, they are written to the
+// default namespace.
+func (k *k8scli) RecordNodeEvent(eventType string, reason string, message string) {
+	node := &v1.ObjectReference{
+		Kind: "Node",
+		Name: NodeName(),
+		// The kubelet uses the node name as UID in node events
+		UID: types.UID(NodeName()),
+	}
+	k.recorder.Event(node, eventType, reason, message)
+}
+
+// Shutdown stops recording events
+func (k *k8scli) Shutdown() {
+	k.broadcaster.Shutdown()
 }
 
 // NodeName returns the name of the k8s node we're running on.
@@ -59,6 +198,14 @@ func NodeName() string {
 	return nodeName
 }
 
+// PodName returns the name of the pod we're running in.
+func PodName() string {
+	if podName == "" {
+		podName = os.Getenv("POD_NAME")
+	}
+	return podName
+}
+
 // GetKubernetesNamespace returns the kubernetes namespace we're running under,
 // or an empty string if the namespace cannot be determined.
 func GetKubernetesNamespace() string {
@@ -71,3 +218,23 @@ func GetKubernetesNamespace() string {
 	}
 	return os.Getenv("KUBERNETES_NAMESPACE")
 }
+
+// LabelNode sets the labels on the node we're running on; labels with a nil value
+// are removed.
+func (k *k8scli) LabelNode(ctx context.Context, labels map[string]*string) error {
+	if NodeName() == "" {
+		return fmt.Errorf("node name is not set")
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding node labels: %w", err)
+	}
+	if _, err := k.nodes.Patch(ctx, NodeName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error labeling node: %w", err)
+	}
+	return nil
+}
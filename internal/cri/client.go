@@ -0,0 +1,104 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cri
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// maxMessageSize is the maximum size of a response message. The verbose status of
+// containerd includes its whole CRI plugin config.
+const maxMessageSize = 16 << 20
+
+// Client is a client of the CRI runtime service
+type Client struct {
+	socket  string
+	conn    *grpc.ClientConn
+	runtime runtimeapi.RuntimeServiceClient
+}
+
+// NewClient creates a client for the CRI socket at the specified path. The
+// connection is established on the first call.
+func NewClient(socket string) (*Client, error) {
+	conn, err := grpc.NewClient("unix://"+socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CRI client for %s: %w", socket, err)
+	}
+	return &Client{
+		socket:  socket,
+		conn:    conn,
+		runtime: runtimeapi.NewRuntimeServiceClient(conn),
+	}, nil
+}
+
+// Status returns the verbose status of the runtime
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	resp, err := c.runtime.Status(ctx, &runtimeapi.StatusRequest{Verbose: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the status of the runtime serving %s: %w", c.socket, err)
+	}
+
+	s := &Status{Info: resp.Info}
+	for _, cond := range resp.GetStatus().GetConditions() {
+		s.Conditions = append(s.Conditions, Condition{
+			Type:    cond.Type,
+			Status:  cond.Status,
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+	for _, h := range resp.RuntimeHandlers {
+		s.Handlers = append(s.Handlers, h.Name)
+	}
+	return s, nil
+}
+
+// RuntimeConfig returns the config of the runtime, or nil if the runtime predates
+// the RuntimeConfig call or does not report a Linux config
+func (c *Client) RuntimeConfig(ctx context.Context) (*RuntimeConfig, error) {
+	resp, err := c.runtime.RuntimeConfig(ctx, &runtimeapi.RuntimeConfigRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the config of the runtime serving %s: %w", c.socket, err)
+	}
+	if resp.GetLinux() == nil {
+		return nil, nil
+	}
+
+	config := &RuntimeConfig{CgroupDriver: CgroupDriverCgroupfs}
+	if resp.Linux.CgroupDriver == runtimeapi.CgroupDriver_SYSTEMD {
+		config.CgroupDriver = CgroupDriverSystemd
+	}
+	return config, nil
+}
+
+// Close releases the connection of the client
+func (c *Client) Close() {
+	c.conn.Close()
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cri
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri/fake"
+)
+
+// newClient returns a client of the socket closed at the end of the test
+func newClient(t *testing.T, socket string) *Client {
+	c, err := NewClient(socket)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// serve starts serving the fake runtime on a socket and returns the socket path
+func serve(t *testing.T, f *fake.Runtime) string {
+	socket := filepath.Join(t.TempDir(), "cri.sock")
+	require.NoError(t, f.Serve(socket))
+	t.Cleanup(func() { f.Close() })
+	return socket
+}
+
+func TestStatus(t *testing.T) {
+	f := &fake.Runtime{
+		Ready:    true,
+		Handlers: []string{"runc", "kata-qemu-nvidia-gpu"},
+		Info:     map[string]string{"lastCNILoadStatus": "OK"},
+	}
+	c := newClient(t, serve(t, f))
+
+	status, err := c.Status(context.Background())
+	require.NoError(t, err)
+	require.True(t, status.Ready())
+	require.Equal(t, map[string]string{"lastCNILoadStatus": "OK"}, status.Info)
+
+	handlers, ok := status.RuntimeHandlers()
+	require.True(t, ok)
+	require.Equal(t, []string{"runc", "kata-qemu-nvidia-gpu"}, handlers)
+}
+
+func TestRuntimeHandlersFromConfig(t *testing.T) {
+	status := &Status{
+		Info: map[string]string{
+			"config": `{"containerd":{"runtimes":{"runc":{},"kata-qemu-nvidia-gpu":{"runtimeType":"io.containerd.kata.v2"}}}}`,
+		},
+	}
+	handlers, ok := status.RuntimeHandlers()
+	require.True(t, ok)
+	require.Equal(t, []string{"kata-qemu-nvidia-gpu", "runc"}, handlers)
+
+	_, ok = (&Status{}).RuntimeHandlers()
+	require.False(t, ok)
+}
+
+func TestWaitForHandlers(t *testing.T) {
+	f := &fake.Runtime{Ready: true, Handlers: []string{"runc"}}
+	c := newClient(t, serve(t, f))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.WaitForHandlers(ctx, []Handler{{Name: "kata"}}, 10*time.Millisecond)
+	var missing *MissingHandlersError
+	require.ErrorAs(t, err, &missing)
+	require.Equal(t, []string{"kata"}, missing.Handlers)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		f.SetHandlers("runc", "kata")
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.WaitForHandlers(ctx, []Handler{{Name: "kata"}}, 10*time.Millisecond))
+}
+
+func TestStatusError(t *testing.T) {
+	c := newClient(t, filepath.Join(t.TempDir(), "missing.sock"))
+
+	_, err := c.Status(context.Background())
+	require.Error(t, err)
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	c := newClient(t, serve(t, &fake.Runtime{CgroupDriver: CgroupDriverCgroupfs}))
+	config, err := c.RuntimeConfig(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, &RuntimeConfig{CgroupDriver: CgroupDriverCgroupfs}, config)
+
+	// Runtimes predating the RuntimeConfig call
+	c = newClient(t, serve(t, &fake.Runtime{}))
+	config, err = c.RuntimeConfig(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, config)
+}
+
+func TestWaitForHandlersCgroupDriver(t *testing.T) {
+	systemd, cgroupfs := true, false
+	testCases := []struct {
+		description   string
+		cgroupDriver  string
+		handlers      []Handler
+		expectedError bool
+	}{
+		{
+			description:  "matching cgroup driver",
+			cgroupDriver: CgroupDriverSystemd,
+			handlers:     []Handler{{Name: "kata", SystemdCgroup: &systemd}},
+		},
+		{
+			description:   "mismatching cgroup driver",
+			cgroupDriver:  CgroupDriverSystemd,
+			handlers:      []Handler{{Name: "runc"}, {Name: "kata", SystemdCgroup: &cgroupfs}},
+			expectedError: true,
+		},
+		{
+			description:  "handler using the default cgroup driver",
+			cgroupDriver: CgroupDriverCgroupfs,
+			handlers:     []Handler{{Name: "kata"}},
+		},
+		{
+			description: "cgroup driver not reported",
+			handlers:    []Handler{{Name: "kata", SystemdCgroup: &systemd}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := &fake.Runtime{Ready: true, Handlers: []string{"runc", "kata"}, CgroupDriver: tc.cgroupDriver}
+			c := newClient(t, serve(t, f))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := c.WaitForHandlers(ctx, tc.handlers, 10*time.Millisecond)
+			if !tc.expectedError {
+				require.NoError(t, err)
+				return
+			}
+			var driverErr *CgroupDriverError
+			require.ErrorAs(t, err, &driverErr)
+			require.Equal(t, &CgroupDriverError{Handler: "kata", CgroupDriver: tc.cgroupDriver}, driverErr)
+		})
+	}
+}
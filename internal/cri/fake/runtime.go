@@ -0,0 +1,120 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fake provides a fake CRI runtime service for tests
+package fake
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// Runtime is a fake CRI runtime service serving the Status and RuntimeConfig calls
+// over a unix socket
+type Runtime struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+
+	sync.Mutex
+	// Ready is reported as the RuntimeReady condition
+	Ready bool
+	// Handlers are reported as the runtime handlers
+	Handlers []string
+	// Info is reported as the verbose information of the runtime
+	Info map[string]string
+	// CgroupDriver, systemd or cgroupfs, is reported through the RuntimeConfig call,
+	// which is unimplemented if it is empty
+	CgroupDriver string
+	// Calls counts the calls received
+	Calls int
+
+	server *grpc.Server
+}
+
+// SetHandlers sets the runtime handlers reported by the runtime
+func (f *Runtime) SetHandlers(handlers ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.Handlers = handlers
+}
+
+// SetReady sets the readiness reported by the runtime
+func (f *Runtime) SetReady(ready bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.Ready = ready
+}
+
+// Serve starts serving the runtime service on the socket
+func (f *Runtime) Serve(socket string) error {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	f.server = grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(f.server, f)
+	go func() { _ = f.server.Serve(l) }()
+	return nil
+}
+
+// Close stops serving the runtime service
+func (f *Runtime) Close() error {
+	if f.server == nil {
+		return nil
+	}
+	f.server.Stop()
+	return nil
+}
+
+// Status reports the readiness, the runtime handlers and the information of the runtime
+func (f *Runtime) Status(context.Context, *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.Calls++
+
+	resp := &runtimeapi.StatusResponse{
+		Status: &runtimeapi.RuntimeStatus{
+			Conditions: []*runtimeapi.RuntimeCondition{{Type: runtimeapi.RuntimeReady, Status: f.Ready}},
+		},
+		Info: f.Info,
+	}
+	for _, h := range f.Handlers {
+		resp.RuntimeHandlers = append(resp.RuntimeHandlers, &runtimeapi.RuntimeHandler{Name: h})
+	}
+	return resp, nil
+}
+
+// RuntimeConfig reports the cgroup driver of the runtime
+func (f *Runtime) RuntimeConfig(ctx context.Context, req *runtimeapi.RuntimeConfigRequest) (*runtimeapi.RuntimeConfigResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.Calls++
+
+	if f.CgroupDriver == "" {
+		return f.UnimplementedRuntimeServiceServer.RuntimeConfig(ctx, req)
+	}
+	driver := runtimeapi.CgroupDriver_CGROUPFS
+	if f.CgroupDriver == "systemd" {
+		driver = runtimeapi.CgroupDriver_SYSTEMD
+	}
+	return &runtimeapi.RuntimeConfigResponse{
+		Linux: &runtimeapi.LinuxRuntimeConfiguration{CgroupDriver: driver},
+	}, nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cri
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const (
+	// RuntimeReady is the condition reported once the runtime is up and ready to
+	// accept containers
+	RuntimeReady = "RuntimeReady"
+)
+
+// Cgroup drivers reported by the runtime
+const (
+	CgroupDriverSystemd  = "systemd"
+	CgroupDriverCgroupfs = "cgroupfs"
+)
+
+// Status is the status of a runtime as reported through the CRI Status call
+type Status struct {
+	Conditions []Condition
+	// Handlers are the runtime handlers reported by runtimes implementing CRI v1.30
+	// or later
+	Handlers []string
+	// Info holds the verbose information of the runtime
+	Info map[string]string
+}
+
+// Condition is a condition of the runtime
+type Condition struct {
+	Type    string
+	Status  bool
+	Reason  string
+	Message string
+}
+
+// Ready returns true if the runtime reports the RuntimeReady condition
+func (s *Status) Ready() bool {
+	for _, c := range s.Conditions {
+		if c.Type == RuntimeReady {
+			return c.Status
+		}
+	}
+	return false
+}
+
+// RuntimeHandlers returns the names of the runtime handlers known to the runtime,
+// and false if the runtime does not report them. Runtimes predating the
+// runtime_handlers status field are supported through the runtimes of the CRI
+// plugin config in the verbose information reported by containerd.
+func (s *Status) RuntimeHandlers() ([]string, bool) {
+	if len(s.Handlers) > 0 {
+		return s.Handlers, true
+	}
+
+	config, ok := s.Info["config"]
+	if !ok {
+		return nil, false
+	}
+	var cri struct {
+		Containerd struct {
+			Runtimes map[string]json.RawMessage `json:"runtimes"`
+		} `json:"containerd"`
+	}
+	if err := json.Unmarshal([]byte(config), &cri); err != nil || cri.Containerd.Runtimes == nil {
+		return nil, false
+	}
+
+	var handlers []string
+	for name := range cri.Containerd.Runtimes {
+		handlers = append(handlers, name)
+	}
+	sort.Strings(handlers)
+	return handlers, true
+}
+
+// RuntimeConfig is the config of a runtime as reported through the CRI RuntimeConfig
+// call
+type RuntimeConfig struct {
+	// CgroupDriver is the cgroup driver used by the runtime, systemd or cgroupfs
+	CgroupDriver string
+}
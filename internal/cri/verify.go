@@ -0,0 +1,146 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// MissingHandlersError is returned when runtime handlers are not registered with the runtime
+type MissingHandlersError struct {
+	Handlers []string
+}
+
+func (e *MissingHandlersError) Error() string {
+	return fmt.Sprintf("runtime handlers %q are not registered with the runtime", e.Handlers)
+}
+
+// CgroupDriverError is returned when a runtime handler is configured for a cgroup
+// driver other than the one of the runtime
+type CgroupDriverError struct {
+	Handler      string
+	CgroupDriver string
+}
+
+func (e *CgroupDriverError) Error() string {
+	return fmt.Sprintf("runtime handler %s does not use the %s cgroup driver of the runtime", e.Handler, e.CgroupDriver)
+}
+
+// Handler is a runtime handler expected to be registered with the runtime
+type Handler struct {
+	Name string
+	// SystemdCgroup is whether the handler is configured for the systemd cgroup
+	// driver, or nil if it uses the default of the runtime
+	SystemdCgroup *bool
+}
+
+// WaitForHandlers polls the status of the runtime until it is ready and all runtime
+// handlers are registered, or the context is done. Handlers are not verified if the
+// runtime does not report them. The cgroup driver of the handlers is then checked
+// against the one reported by the runtime.
+func (c *Client) WaitForHandlers(ctx context.Context, handlers []Handler, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		err := c.checkHandlers(ctx, handlers)
+		if err == nil {
+			return c.checkCgroupDriver(ctx, handlers)
+		}
+		// Keep the error of the last check that was not interrupted by the context
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+		klog.V(2).Infof("Runtime not ready yet: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) checkHandlers(ctx context.Context, handlers []Handler) error {
+	status, err := c.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if !status.Ready() {
+		return fmt.Errorf("runtime is not ready")
+	}
+
+	registered, ok := status.RuntimeHandlers()
+	if !ok {
+		klog.Warningf("The runtime does not report its runtime handlers, unable to verify %q", handlerNames(handlers))
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, h := range registered {
+		known[h] = true
+	}
+	var missing []string
+	for _, h := range handlers {
+		if !known[h.Name] {
+			missing = append(missing, h.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingHandlersError{Handlers: missing}
+	}
+	return nil
+}
+
+// checkCgroupDriver checks that the handlers configured for a cgroup driver use the
+// cgroup driver of the runtime. The check is skipped if the runtime does not report
+// its cgroup driver.
+func (c *Client) checkCgroupDriver(ctx context.Context, handlers []Handler) error {
+	config, err := c.RuntimeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		klog.V(2).Infof("The runtime does not report its cgroup driver, unable to verify the runtime handlers")
+		return nil
+	}
+
+	var errs []error
+	for _, h := range handlers {
+		if h.SystemdCgroup == nil {
+			continue
+		}
+		if *h.SystemdCgroup != (config.CgroupDriver == CgroupDriverSystemd) {
+			errs = append(errs, &CgroupDriverError{Handler: h.Name, CgroupDriver: config.CgroupDriver})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func handlerNames(handlers []Handler) []string {
+	names := make([]string, 0, len(handlers))
+	for _, h := range handlers {
+		names = append(names, h.Name)
+	}
+	return names
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Action is the action taken on a host file
+type Action string
+
+const (
+	// Create means the file is created
+	Create Action = "create"
+	// Update means the content of the file changes
+	Update Action = "update"
+	// Remove means the file is removed
+	Remove Action = "remove"
+	// Unchanged means the file is left as is
+	Unchanged Action = "unchanged"
+)
+
+// Plan describes the changes k8s-kata-manager would make to the host
+type Plan struct {
+	RuntimeClasses []RuntimeClass `json:"runtimeClasses"`
+	Files          []File         `json:"files"`
+	KernelModules  []string       `json:"kernelModules,omitempty"`
+	// Restart is true if the container runtime would be restarted
+	Restart bool `json:"restart"`
+}
+
+// RuntimeClass describes the installation of a runtime class
+type RuntimeClass struct {
+	Name       string         `json:"name"`
+	Artifact   string         `json:"artifact"`
+	Directory  string         `json:"directory"`
+	KataConfig string         `json:"kataConfig,omitempty"`
+	Files      []ArtifactFile `json:"files,omitempty"`
+	// Error is the reason the runtime class would not be installed
+	Error string `json:"error,omitempty"`
+}
+
+// ArtifactFile is a file written to the artifacts directory of a runtime class
+type ArtifactFile struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	// Unpack is true if the file is an archive extracted to Path
+	Unpack bool `json:"unpack,omitempty"`
+}
+
+// File describes the change of a host file
+type File struct {
+	Path   string `json:"path"`
+	Action Action `json:"action"`
+	// Error is set if the content of the file could not be determined
+	Error string `json:"error,omitempty"`
+
+	diff string
+}
+
+// AddFile adds the change of a host file to the plan and returns true if the file
+// changes. Old is nil if the file does not exist and new is nil if it is removed.
+func (p *Plan) AddFile(path string, old []byte, new []byte) (bool, error) {
+	f := File{Path: path}
+	switch {
+	case old == nil && new == nil:
+		return false, nil
+	case old == nil:
+		f.Action = Create
+	case new == nil:
+		f.Action = Remove
+	case string(old) == string(new):
+		f.Action = Unchanged
+	default:
+		f.Action = Update
+	}
+
+	if f.Action != Unchanged {
+		diff, err := unifiedDiff(path, old, new)
+		if err != nil {
+			return false, fmt.Errorf("unable to diff '%s': %w", path, err)
+		}
+		f.diff = diff
+	}
+
+	p.Files = append(p.Files, f)
+	return f.Action != Unchanged, nil
+}
+
+// AddFileError records a host file whose change could not be determined
+func (p *Plan) AddFileError(path string, err error) {
+	p.Files = append(p.Files, File{Path: path, Error: err.Error()})
+}
+
+// WriteDiff writes the unified diff of all changed files
+func (p *Plan) WriteDiff(w io.Writer) error {
+	for _, f := range p.Files {
+		if _, err := io.WriteString(w, f.diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the plan as JSON
+func (p *Plan) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(p)
+}
+
+func unifiedDiff(path string, old []byte, new []byte) (string, error) {
+	diff := difflib.UnifiedDiff{
+		A:        splitLines(old),
+		B:        splitLines(new),
+		FromFile: "a" + path,
+		ToFile:   "b" + path,
+		Context:  3,
+	}
+	if old == nil {
+		diff.A = nil
+		diff.FromFile = "/dev/null"
+	}
+	if new == nil {
+		diff.B = nil
+		diff.ToFile = "/dev/null"
+	}
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// splitLines splits content into lines that keep their line ending. A missing line
+// ending on the last line is added so that the diff stays line oriented.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
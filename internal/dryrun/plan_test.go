@@ -0,0 +1,112 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAddFile(t *testing.T) {
+	testCases := []struct {
+		description     string
+		old             []byte
+		new             []byte
+		expectedChanged bool
+		expectedAction  Action
+		expectedDiff    string
+	}{
+		{
+			description:     "created file",
+			new:             []byte("a = 1\n"),
+			expectedChanged: true,
+			expectedAction:  Create,
+			expectedDiff: `--- /dev/null
++++ b/etc/config.toml
+@@ -0,0 +1 @@
++a = 1
+`,
+		},
+		{
+			description:     "updated file",
+			old:             []byte("a = 1\nb = 2\n"),
+			new:             []byte("a = 1\nb = 3\n"),
+			expectedChanged: true,
+			expectedAction:  Update,
+			expectedDiff: `--- a/etc/config.toml
++++ b/etc/config.toml
+@@ -1,2 +1,2 @@
+ a = 1
+-b = 2
++b = 3
+`,
+		},
+		{
+			description:     "removed file",
+			old:             []byte("a = 1\n"),
+			expectedChanged: true,
+			expectedAction:  Remove,
+			expectedDiff: `--- a/etc/config.toml
++++ /dev/null
+@@ -1 +0,0 @@
+-a = 1
+`,
+		},
+		{
+			description:    "unchanged file",
+			old:            []byte("a = 1\n"),
+			new:            []byte("a = 1\n"),
+			expectedAction: Unchanged,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			plan := &Plan{}
+			changed, err := plan.AddFile("/etc/config.toml", tc.old, tc.new)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedChanged, changed)
+			require.Len(t, plan.Files, 1)
+			require.Equal(t, tc.expectedAction, plan.Files[0].Action)
+
+			var diff bytes.Buffer
+			require.NoError(t, plan.WriteDiff(&diff))
+			require.Equal(t, tc.expectedDiff, diff.String())
+		})
+	}
+}
+
+func TestPlanWriteJSON(t *testing.T) {
+	plan := &Plan{
+		RuntimeClasses: []RuntimeClass{{Name: "kata", Artifact: "nvcr.io/kata:latest", Directory: "/artifacts/kata"}},
+		KernelModules:  []string{"vhost-vsock"},
+		Restart:        true,
+	}
+	_, err := plan.AddFile("/etc/config.toml", nil, []byte("a = 1\n"))
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	require.NoError(t, plan.WriteJSON(&output))
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	require.Equal(t, true, decoded["restart"])
+	require.Equal(t, []interface{}{map[string]interface{}{"path": "/etc/config.toml", "action": "create"}}, decoded["files"])
+}
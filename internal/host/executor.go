@@ -0,0 +1,253 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Operation is an operation the host executor runs on the host. Only the operations
+// defined here are allowed, and their arguments are validated before running them.
+type Operation string
+
+const (
+	// Modprobe loads the kernel module given as first argument; further arguments are
+	// module parameters in key=value form
+	Modprobe Operation = "modprobe"
+	// CrioStatusConfig prints the effective CRI-O config; it takes no arguments
+	CrioStatusConfig Operation = "crio-status-config"
+	// SystemdRestartUnit restarts the systemd unit given as argument through D-Bus
+	SystemdRestartUnit Operation = "systemd-restart-unit"
+	// SystemdReloadUnit reloads the systemd unit given as argument through D-Bus
+	SystemdReloadUnit Operation = "systemd-reload-unit"
+	// Shell runs the operator-provided command given as argument with /bin/sh -c
+	Shell Operation = "shell"
+)
+
+// hostMountNamespace is the mount namespace of the host init process
+const hostMountNamespace = "/proc/1/ns/mnt"
+
+// ErrNotAllowed is returned for operations which are not allowed or have invalid
+// arguments
+var ErrNotAllowed = errors.New("operation not allowed")
+
+var (
+	moduleName  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	moduleParam = regexp.MustCompile(`^[A-Za-z0-9_]+=\S*$`)
+	unitName    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]*\.service$`)
+	nonEmpty    = regexp.MustCompile(`\S`)
+)
+
+// operation describes how an allowed operation is run
+type operation struct {
+	validate func(args []string) error
+	// command returns the command line of the operation
+	command func(args []string) []string
+	// native runs the operation through a native API instead of a command
+	native  func(ctx context.Context, e *executor, args []string) error
+	timeout time.Duration
+}
+
+var operations = map[Operation]operation{
+	Modprobe: {
+		validate: validateModprobe,
+		command:  func(args []string) []string { return append([]string{"modprobe"}, args...) },
+		timeout:  time.Minute,
+	},
+	CrioStatusConfig: {
+		validate: func(args []string) error { return validateArgs(args, 0, nil) },
+		command:  func([]string) []string { return []string{"crio", "status", "config"} },
+		timeout:  30 * time.Second,
+	},
+	SystemdRestartUnit: {
+		validate: func(args []string) error { return validateArgs(args, 1, unitName) },
+		native: func(ctx context.Context, e *executor, args []string) error {
+			return e.systemdUnitCall(ctx, "RestartUnit", args[0])
+		},
+		timeout: 30 * time.Second,
+	},
+	SystemdReloadUnit: {
+		validate: func(args []string) error { return validateArgs(args, 1, unitName) },
+		native: func(ctx context.Context, e *executor, args []string) error {
+			return e.systemdUnitCall(ctx, "ReloadUnit", args[0])
+		},
+		timeout: 30 * time.Second,
+	},
+	Shell: {
+		validate: func(args []string) error { return validateArgs(args, 1, nonEmpty) },
+		command:  func(args []string) []string { return []string{"/bin/sh", "-c", args[0]} },
+		timeout:  2 * time.Minute,
+	},
+}
+
+// Executor runs allowed operations on the host
+type Executor interface {
+	// Run runs the operation with the arguments on the host and returns its output.
+	// Operations failing on the host return a *CommandError.
+	Run(ctx context.Context, op Operation, args ...string) ([]byte, error)
+}
+
+// CommandError is returned when an operation fails on the host
+type CommandError struct {
+	Operation Operation
+	Args      []string
+	// ExitCode is the exit code of the command, or -1 if it did not exit or the
+	// operation does not run a command
+	ExitCode int
+	// Stderr is the error output of the command
+	Stderr string
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s failed: %v", strings.Join(append([]string{string(e.Operation)}, e.Args...), " "), e.Err)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Validate returns an error wrapping ErrNotAllowed unless the operation is allowed
+// with the arguments
+func Validate(op Operation, args ...string) error {
+	o, ok := operations[op]
+	if !ok {
+		return fmt.Errorf("%w: unknown operation %q", ErrNotAllowed, op)
+	}
+	if err := o.validate(args); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrNotAllowed, op, err)
+	}
+	return nil
+}
+
+type executor struct {
+	root    Root
+	timeout time.Duration
+	// dialSystemd connects to systemd through the system bus socket at the path
+	dialSystemd func(ctx context.Context, bus string) (systemdConn, error)
+}
+
+// ExecutorOption is a functional option for the host executor
+type ExecutorOption func(*executor)
+
+// WithTimeout bounds the time every operation may take, overriding the default
+// timeout of the operation
+func WithTimeout(timeout time.Duration) ExecutorOption {
+	return func(e *executor) {
+		e.timeout = timeout
+	}
+}
+
+// NewExecutor returns an executor running operations on the host mounted at root.
+// Commands are run with nsenter in the mount namespace of the host init process,
+// unless root is the local root, in which case they are run directly. systemd is
+// called through its D-Bus socket on the host.
+func NewExecutor(root Root, opts ...ExecutorOption) Executor {
+	e := &executor{root: root, dialSystemd: dialSystemd}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *executor) Run(ctx context.Context, op Operation, args ...string) ([]byte, error) {
+	if err := Validate(op, args...); err != nil {
+		return nil, err
+	}
+	o := operations[op]
+
+	timeout := o.timeout
+	if e.timeout != 0 {
+		timeout = e.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if o.native != nil {
+		if err := o.native(ctx, e, args); err != nil {
+			return nil, &CommandError{Operation: op, Args: args, ExitCode: -1, Err: err}
+		}
+		return nil, nil
+	}
+
+	command := e.commandLine(o.command(args))
+	klog.V(2).Infof("Running on the host: %v", command)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		cmdErr := &CommandError{Operation: op, Args: args, ExitCode: -1, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cmdErr.ExitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() != nil {
+			cmdErr.Err = fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return stdout.Bytes(), cmdErr
+	}
+	return stdout.Bytes(), nil
+}
+
+// commandLine returns the command line running the command in the host mount
+// namespace
+func (e *executor) commandLine(command []string) []string {
+	if e.root.Path("/") == "/" {
+		return command
+	}
+	return append([]string{"nsenter", "--mount=" + e.root.Path(hostMountNamespace), "--"}, command...)
+}
+
+func validateModprobe(args []string) error {
+	if len(args) == 0 || !moduleName.MatchString(args[0]) {
+		return fmt.Errorf("invalid module name %q", strings.Join(args, " "))
+	}
+	for _, param := range args[1:] {
+		if !moduleParam.MatchString(param) {
+			return fmt.Errorf("invalid module parameter %q", param)
+		}
+	}
+	return nil
+}
+
+// validateArgs checks the number of arguments and that each matches the pattern
+func validateArgs(args []string, n int, pattern *regexp.Regexp) error {
+	if len(args) != n {
+		return fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	for _, arg := range args {
+		if !pattern.MatchString(arg) {
+			return fmt.Errorf("invalid argument %q", arg)
+		}
+	}
+	return nil
+}
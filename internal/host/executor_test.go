@@ -0,0 +1,144 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		op            Operation
+		args          []string
+		expectedError bool
+	}{
+		{op: Modprobe, args: []string{"vhost_vsock"}},
+		{op: Modprobe, args: []string{"kvm_amd", "sev_snp=1", "nested=0"}},
+		{op: Modprobe, expectedError: true},
+		{op: Modprobe, args: []string{"-r", "kvm"}, expectedError: true},
+		{op: Modprobe, args: []string{"vfio-pci", "ids=10de:2330; reboot"}, expectedError: true},
+		{op: CrioStatusConfig},
+		{op: CrioStatusConfig, args: []string{"--help"}, expectedError: true},
+		{op: SystemdRestartUnit, args: []string{"crio.service"}},
+		{op: SystemdReloadUnit, args: []string{"containerd.service"}},
+		{op: SystemdRestartUnit, args: []string{"reboot.target"}, expectedError: true},
+		{op: Shell, args: []string{"systemctl restart containerd"}},
+		{op: Shell, args: []string{" "}, expectedError: true},
+		{op: "rm", args: []string{"-rf", "/"}, expectedError: true},
+	}
+	for _, tc := range testCases {
+		err := Validate(tc.op, tc.args...)
+		if tc.expectedError {
+			require.ErrorIs(t, err, ErrNotAllowed, "%s %v", tc.op, tc.args)
+			continue
+		}
+		require.NoError(t, err, "%s %v", tc.op, tc.args)
+	}
+}
+
+func TestExecutorCommandLine(t *testing.T) {
+	command := []string{"modprobe", "vhost_vsock"}
+	require.Equal(t, command, (&executor{}).commandLine(command))
+	require.Equal(t, command, (&executor{root: "/"}).commandLine(command))
+	require.Equal(t,
+		[]string{"nsenter", "--mount=/host/proc/1/ns/mnt", "--", "modprobe", "vhost_vsock"},
+		(&executor{root: "/host"}).commandLine(command),
+	)
+}
+
+func TestExecutorRun(t *testing.T) {
+	e := NewExecutor("")
+
+	output, err := e.Run(context.Background(), Shell, "echo kata")
+	require.NoError(t, err)
+	require.Equal(t, "kata\n", string(output))
+
+	_, err = e.Run(context.Background(), Shell, "echo out; echo 'no such module' >&2; exit 3")
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	require.Equal(t, Shell, cmdErr.Operation)
+	require.Equal(t, 3, cmdErr.ExitCode)
+	require.Equal(t, "no such module", cmdErr.Stderr)
+	require.ErrorContains(t, err, "exit status 3: no such module")
+
+	_, err = e.Run(context.Background(), Modprobe, "-r", "kvm")
+	require.ErrorIs(t, err, ErrNotAllowed)
+}
+
+func TestExecutorTimeout(t *testing.T) {
+	e := NewExecutor("", WithTimeout(100*time.Millisecond))
+
+	start := time.Now()
+	_, err := e.Run(context.Background(), Shell, "sleep 10")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	require.Equal(t, -1, cmdErr.ExitCode)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+// fakeSystemd is a fake systemd manager completing the jobs of all units but
+// failedUnit
+type fakeSystemd struct {
+	calls      []string
+	failedUnit string
+}
+
+func (s *fakeSystemd) RestartUnitContext(_ context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return s.job("RestartUnit", name, mode, ch)
+}
+
+func (s *fakeSystemd) ReloadUnitContext(_ context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return s.job("ReloadUnit", name, mode, ch)
+}
+
+func (s *fakeSystemd) job(method string, name string, mode string, ch chan<- string) (int, error) {
+	s.calls = append(s.calls, method+" "+name+" "+mode)
+	if name == s.failedUnit {
+		ch <- "failed"
+	} else {
+		ch <- "done"
+	}
+	return len(s.calls), nil
+}
+
+func (s *fakeSystemd) Close() {}
+
+func TestExecutorSystemd(t *testing.T) {
+	root := Root(t.TempDir())
+	systemd := &fakeSystemd{failedUnit: "crio.service"}
+	var bus string
+	e := &executor{root: root, dialSystemd: func(_ context.Context, path string) (systemdConn, error) {
+		bus = path
+		return systemd, nil
+	}}
+
+	_, err := e.Run(context.Background(), SystemdReloadUnit, "containerd.service")
+	require.NoError(t, err)
+	require.Equal(t, root.Path(dbusSystemBusPath), bus)
+	require.Equal(t, []string{"ReloadUnit containerd.service replace"}, systemd.calls)
+
+	_, err = e.Run(context.Background(), SystemdRestartUnit, "crio.service")
+	require.ErrorContains(t, err, `finished with result "failed"`)
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	require.Equal(t, SystemdRestartUnit, cmdErr.Operation)
+}
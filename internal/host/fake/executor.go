@@ -0,0 +1,63 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fake provides a fake host executor for tests
+package fake
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+)
+
+// Executor is a fake host executor recording the operations it is asked to run.
+// Operations are validated like by the host executor, but nothing is run.
+type Executor struct {
+	sync.Mutex
+	// Calls are the operations run, each formatted as the operation followed by its
+	// arguments separated by spaces
+	Calls []string
+	// Outputs are the outputs returned for calls, keyed like Calls
+	Outputs map[string]string
+	// Errors are the errors returned for calls, keyed like Calls
+	Errors map[string]error
+	// Hooks are run for successful calls, keyed like Calls, e.g. to apply the effect
+	// of a call to a fake host tree
+	Hooks map[string]func()
+}
+
+var _ host.Executor = (*Executor)(nil)
+
+// Run records the call and returns the output or error configured for it
+func (f *Executor) Run(_ context.Context, op host.Operation, args ...string) ([]byte, error) {
+	if err := host.Validate(op, args...); err != nil {
+		return nil, err
+	}
+	call := strings.Join(append([]string{string(op)}, args...), " ")
+
+	f.Lock()
+	defer f.Unlock()
+	f.Calls = append(f.Calls, call)
+	if err, ok := f.Errors[call]; ok {
+		return nil, err
+	}
+	if hook, ok := f.Hooks[call]; ok {
+		hook()
+	}
+	return []byte(f.Outputs[call]), nil
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Root is the path the host root filesystem is mounted at. Paths on the host are
+// resolved against it to access them locally. The zero value is the local root.
+type Root string
+
+// Path returns the local path of a path on the host
+func (r Root) Path(hostPath string) string {
+	if r == "" {
+		return hostPath
+	}
+	return filepath.Join(string(r), hostPath)
+}
+
+// HostPath returns the path on the host of a local path below the root. Paths
+// outside of the root, or relative paths, are returned unchanged.
+func (r Root) HostPath(path string) string {
+	if r == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(r.Path("/"), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return path
+	}
+	return filepath.Join("/", rel)
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoot(t *testing.T) {
+	testCases := []struct {
+		root     Root
+		hostPath string
+		path     string
+	}{
+		{root: "", hostPath: "/etc/containerd/config.toml", path: "/etc/containerd/config.toml"},
+		{root: "/", hostPath: "/etc/containerd/config.toml", path: "/etc/containerd/config.toml"},
+		{root: "/host", hostPath: "/etc/containerd/config.toml", path: "/host/etc/containerd/config.toml"},
+		{root: "/host/", hostPath: "/run/crio/crio.sock", path: "/host/run/crio/crio.sock"},
+		{root: "/host", hostPath: "/", path: "/host"},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.root)+tc.hostPath, func(t *testing.T) {
+			require.Equal(t, tc.path, tc.root.Path(tc.hostPath))
+			require.Equal(t, tc.hostPath, tc.root.HostPath(tc.path))
+		})
+	}
+}
+
+func TestRootHostPathOutsideRoot(t *testing.T) {
+	root := Root("/host")
+	require.Equal(t, "/hostile/file", root.HostPath("/hostile/file"))
+	require.Equal(t, "/var/run/cdi", root.HostPath("/var/run/cdi"))
+	require.Equal(t, "relative/path", root.HostPath("relative/path"))
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package host
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+	"k8s.io/klog/v2"
+)
+
+const dbusSystemBusPath = "/run/dbus/system_bus_socket"
+
+// systemdConn is the subset of the systemd D-Bus API used to manage units
+type systemdConn interface {
+	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	ReloadUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	Close()
+}
+
+// dialSystemd connects to the systemd manager through the D-Bus system bus socket
+func dialSystemd(ctx context.Context, bus string) (systemdConn, error) {
+	conn, err := dbus.NewConnection(func() (*godbus.Conn, error) {
+		conn, err := godbus.Dial("unix:path="+bus, godbus.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Auth(nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	return conn, nil
+}
+
+// systemdUnitCall runs a job restarting or reloading a systemd unit and waits for
+// the job to complete
+func (e *executor) systemdUnitCall(ctx context.Context, method string, unit string) error {
+	klog.Infof("Calling %s for systemd unit %s", method, unit)
+	conn, err := e.dialSystemd(ctx, e.root.Path(dbusSystemBusPath))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	result := make(chan string, 1)
+	var job int
+	switch method {
+	case "RestartUnit":
+		job, err = conn.RestartUnitContext(ctx, unit, "replace", result)
+	case "ReloadUnit":
+		job, err = conn.ReloadUnitContext(ctx, unit, "replace", result)
+	default:
+		return fmt.Errorf("unsupported systemd method %s", method)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to %s %s: %w", method, unit, err)
+	}
+	klog.Infof("Queued systemd job %d", job)
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("systemd job %d did not complete: %w", job, ctx.Err())
+	case r := <-result:
+		if r != "done" {
+			return fmt.Errorf("systemd job %d to %s %s finished with result %q", job, method, unit, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml"
+)
+
+// TransformFile applies the transformers to the kata configuration file at src in
+// order, and writes the result to dst. dst is replaced atomically; src may be the
+// same file as dst.
+func TransformFile(src string, dst string, transformers ...Transformer) error {
+	config, err := toml.LoadFile(src)
+	if err != nil {
+		return fmt.Errorf("error reading TOML file: %w", err)
+	}
+
+	for _, t := range transformers {
+		if err := t.Transform(config); err != nil {
+			return fmt.Errorf("error transforming kata configuration file: %w", err)
+		}
+	}
+
+	output, err := config.ToTomlString()
+	if err != nil {
+		return fmt.Errorf("unable to convert to TOML: %w", err)
+	}
+
+	if len(output) == 0 {
+		return fmt.Errorf("empty kata configuration")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file for '%s': %w", dst, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.WriteString(output)
+	if err != nil {
+		return fmt.Errorf("unable to write output: %w", err)
+	}
+	if err := f.Chmod(0644); err != nil {
+		return fmt.Errorf("unable to set permissions on '%s': %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write output: %w", err)
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("unable to replace '%s': %w", dst, err)
+	}
+
+	return nil
+}
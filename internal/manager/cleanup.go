@@ -0,0 +1,189 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+)
+
+const (
+	// CleanupOnUninstall removes the runtime config only when kata manager is being
+	// uninstalled from the node
+	CleanupOnUninstall = "on-uninstall"
+	// CleanupAlways removes the runtime config whenever kata manager terminates
+	CleanupAlways = "always"
+	// CleanupNever never removes the runtime config
+	CleanupNever = "never"
+
+	// OptOutLabel opts a node out of kata manager when set to false
+	OptOutLabel = "nvidia.com/gpu.deploy.kata-manager"
+	// UninstallAnnotation requests the removal of the runtime config from all nodes
+	// when set to true on the kata manager DaemonSet
+	UninstallAnnotation = RuntimeClassLabelPrefix + "uninstall"
+)
+
+// CleanUp reverts the runtime config added by kata manager
+func (m *Manager) CleanUp(ctx context.Context) error {
+	var names []string
+	for _, rc := range m.config.RuntimeClasses {
+		names = append(names, rc.Name)
+	}
+
+	// Stop advertising the runtime classes before they are removed from the runtime
+	if err := m.labelRuntimeClasses(ctx, names, false); err != nil {
+		klog.Warningf("Unable to remove runtime class labels from node: %v", err)
+	}
+
+	runtimeConfig, err := m.loadRuntime()
+	if err != nil {
+		return fmt.Errorf("error creating runtime config client: %w", err)
+	}
+	for _, rc := range m.config.RuntimeClasses {
+		err := runtimeConfig.RemoveRuntime(rc.Name)
+		if err != nil {
+			return fmt.Errorf("unable to revert config for runtime class '%v': %w", rc.Name, err)
+		}
+	}
+	n, err := runtimeConfig.Save()
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %w", err)
+	}
+
+	if n == 0 {
+		klog.Infof("Removed empty config")
+	} else {
+		klog.Infof("Wrote updated config")
+	}
+	if err := runtimeConfig.Restart(ctx); err != nil {
+		return rollback(ctx, runtimeConfig, fmt.Errorf("unable to restart runtime service: %w", err))
+	}
+	for _, name := range names {
+		m.setRuntimeClassState(name, StateRemoved, "")
+	}
+
+	// The runtime config no longer holds any kata manager settings, so the backups
+	// of the original config are not needed anymore.
+	if err := backup.DiscardAll(BackupDir(m.artifactsDir())); err != nil {
+		klog.Warningf("Unable to discard runtime config backups: %v", err)
+	}
+	if err := m.removePersistedModules(); err != nil {
+		klog.Warningf("Unable to remove persisted kernel modules: %v", err)
+	}
+	return nil
+}
+
+// ShouldCleanUp returns whether the runtime config is removed on termination. With
+// the on-uninstall policy, the config is kept across restarts and upgrades of the
+// kata manager pod, and only removed when the node opts out, the DaemonSet is
+// deleted or an uninstall is requested. Removal is blocked while kata pods are
+// running on the node.
+func (m *Manager) ShouldCleanUp(ctx context.Context) bool {
+	switch m.cleanupPolicy {
+	case CleanupNever:
+		klog.Infof("Keeping runtime config, cleanup policy is %s", m.cleanupPolicy)
+		return false
+	case CleanupAlways:
+	default:
+		reason, err := m.uninstallReason(ctx)
+		if err != nil {
+			klog.Warningf("Keeping runtime config, unable to determine whether kata manager is being uninstalled: %v", err)
+			return false
+		}
+		if reason == "" {
+			klog.Infof("Keeping runtime config for the next kata manager pod")
+			return false
+		}
+		klog.Infof("Removing runtime config, %s", reason)
+	}
+
+	pods, err := m.kataPods(ctx)
+	if err != nil {
+		klog.Warningf("Keeping runtime config, unable to check for running kata pods: %v", err)
+		return false
+	}
+	if len(pods) > 0 {
+		klog.Warningf("Keeping runtime config, kata pods are running on the node: %s", strings.Join(pods, ", "))
+		return false
+	}
+	return true
+}
+
+// uninstallReason returns why kata manager is being uninstalled from the node, or
+// an empty string if it is not
+func (m *Manager) uninstallReason(ctx context.Context) (string, error) {
+	if m.cluster == nil {
+		return "", fmt.Errorf("no cluster client")
+	}
+
+	labels, err := m.cluster.GetNodeLabels(ctx)
+	if err != nil {
+		return "", err
+	}
+	if labels[OptOutLabel] == "false" {
+		return fmt.Sprintf("node opted out through the %s label", OptOutLabel), nil
+	}
+
+	ds, err := m.cluster.GetOwnerDaemonSet(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case ds == nil:
+		return "the kata manager DaemonSet has been deleted", nil
+	case ds.DeletionTimestamp != nil:
+		return "the kata manager DaemonSet is being deleted", nil
+	case ds.Annotations[UninstallAnnotation] == "true":
+		return fmt.Sprintf("uninstall requested through the %s annotation", UninstallAnnotation), nil
+	}
+	return "", nil
+}
+
+// kataPods returns the namespaced names of the pods on the node which use one of the
+// configured runtime classes and have not terminated
+func (m *Manager) kataPods(ctx context.Context) ([]string, error) {
+	if m.cluster == nil {
+		return nil, fmt.Errorf("no cluster client")
+	}
+
+	runtimeClasses := make(map[string]bool)
+	for _, rc := range m.config.RuntimeClasses {
+		runtimeClasses[rc.Name] = true
+	}
+
+	pods, err := m.cluster.ListNodePods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var kataPods []string
+	for _, pod := range pods {
+		if pod.Spec.RuntimeClassName == nil || !runtimeClasses[*pod.Spec.RuntimeClassName] {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		kataPods = append(kataPods, pod.Namespace+"/"+pod.Name)
+	}
+	return kataPods, nil
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/klog/v2"
+	"oras.land/oras-go/v2/content/file"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/artifact"
+	"github.com/NVIDIA/k8s-kata-manager/internal/dryrun"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+)
+
+// DryRun runs the installation pipeline against read-only inputs and returns the
+// changes it would make to the host as a plan. Neither the host nor the runtime are
+// modified.
+func (m *Manager) DryRun(ctx context.Context) (*dryrun.Plan, error) {
+	klog.Info("Running in dry-run mode, the host is not modified")
+	plan := &dryrun.Plan{}
+
+	if m.loadModules {
+		if err := m.planKernelModules(plan); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.cdi != nil {
+		spec, path, err := m.getCDISpec()
+		if err != nil {
+			plan.AddFileError(filepath.Join(m.cdiRoot, "*.yaml"), err)
+		} else if err := m.planCDISpec(plan, spec.Raw(), path); err != nil {
+			return nil, err
+		}
+	}
+
+	runtimeConfig, err := m.loadRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range m.config.RuntimeClasses {
+		rc := &m.config.RuntimeClasses[i]
+		rcPlan, kataConfigPath := m.planRuntimeClass(ctx, rc)
+		plan.RuntimeClasses = append(plan.RuntimeClasses, rcPlan)
+		if rcPlan.Error != "" {
+			continue
+		}
+
+		err = runtimeConfig.AddRuntime(rc.Name, kataConfigPath, runtime.NewRuntimeClassOptions(rc))
+		if err != nil {
+			return nil, fmt.Errorf("unable to update config: %w", err)
+		}
+	}
+
+	changes, err := runtimeConfig.Changes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to render runtime config: %w", err)
+	}
+	for _, c := range changes {
+		changed, err := plan.AddFile(m.root.HostPath(c.Path), c.Old, c.New)
+		if err != nil {
+			return nil, err
+		}
+		plan.Restart = plan.Restart || changed
+	}
+
+	return plan, nil
+}
+
+// planRuntimeClass resolves the artifact of a runtime class and returns the files
+// that would be written for it along with the path of its kata configuration file.
+// The paths in the plan are paths on the host.
+func (m *Manager) planRuntimeClass(ctx context.Context, rc *api.RuntimeClass) (dryrun.RuntimeClass, string) {
+	rcDir := filepath.Join(m.config.ArtifactsDir, rc.Name)
+	rcPlan := dryrun.RuntimeClass{
+		Name:      rc.Name,
+		Artifact:  rc.Artifacts.URL,
+		Directory: rcDir,
+	}
+
+	creds, err := m.credentials.GetCredentials(ctx, *rc)
+	if err != nil {
+		rcPlan.Error = fmt.Sprintf("unable to get credentials: %v", err)
+		return rcPlan, ""
+	}
+
+	manifest, err := m.resolveArtifact(ctx, rc, creds)
+	if err != nil {
+		rcPlan.Error = err.Error()
+		return rcPlan, ""
+	}
+
+	if err := artifact.CheckFreeSpace(existingDir(m.root.Path(rcDir)), artifact.PayloadSize(manifest)); err != nil {
+		rcPlan.Error = err.Error()
+		return rcPlan, ""
+	}
+
+	for _, layer := range manifest.Layers {
+		rcPlan.Files = append(rcPlan.Files, dryrun.ArtifactFile{
+			Path:   filepath.Join(rcDir, layer.Annotations[ocispec.AnnotationTitle]),
+			Digest: layer.Digest.String(),
+			Size:   layer.Size,
+			Unpack: layer.Annotations[file.AnnotationUnpack] == "true",
+		})
+	}
+
+	kataConfig, err := kataConfigName(rc, manifest)
+	if err != nil {
+		rcPlan.Error = err.Error()
+		return rcPlan, ""
+	}
+	rcPlan.KataConfig = transformedKataConfigPath(filepath.Join(rcDir, kataConfig))
+
+	return rcPlan, rcPlan.KataConfig
+}
+
+// kataConfigName returns the name of the kata configuration file of a runtime class
+// as found in the artifact manifest
+func kataConfigName(rc *api.RuntimeClass, manifest *ocispec.Manifest) (string, error) {
+	var candidates []string
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[ocispec.AnnotationTitle]
+		if rc.KataConfig != "" && name == rc.KataConfig {
+			return name, nil
+		}
+		if path.Ext(name) == ".toml" && !strings.Contains(name, "/") {
+			candidates = append(candidates, name)
+		}
+	}
+	if rc.KataConfig != "" {
+		return "", fmt.Errorf("kata config file %s not found for runtime class %s", rc.KataConfig, rc.Name)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no kata config file found for runtime class %s", rc.Name)
+	}
+	sort.Strings(candidates)
+	return candidates[0], nil
+}
+
+// planCDISpec adds the change of the CDI specification at the local path to the plan
+func (m *Manager) planCDISpec(plan *dryrun.Plan, raw interface{}, path string) error {
+	updated, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cdi spec: %w", err)
+	}
+	old, err := runtime.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = plan.AddFile(m.root.HostPath(path), old, updated)
+	return err
+}
+
+// existingDir returns the closest existing directory containing path
+func existingDir(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil || path == filepath.Dir(path) {
+			return path
+		}
+		path = filepath.Dir(path)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri"
+	"github.com/NVIDIA/k8s-kata-manager/internal/oras"
+)
+
+// orasPuller pulls artifacts from OCI registries with ORAS
+type orasPuller struct{}
+
+func (orasPuller) Manifest(ctx context.Context, ref string, creds *auth.Credential) (*ocispec.Manifest, error) {
+	a, err := oras.NewArtifact(ref, "")
+	if err != nil {
+		return nil, fmt.Errorf("error creating artifact: %w", err)
+	}
+	_, manifest, err := a.Manifest(ctx, creds)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching artifact manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func (orasPuller) Pull(ctx context.Context, ref string, dir string, creds *auth.Credential, manifest *ocispec.Manifest, blobs *cache.Cache) error {
+	a, err := oras.NewArtifact(ref, dir)
+	if err != nil {
+		return fmt.Errorf("error creating artifact: %w", err)
+	}
+	if err := a.PullCached(ctx, creds, manifest, blobs); err != nil {
+		return fmt.Errorf("error pulling artifact: %w", err)
+	}
+	return nil
+}
+
+// criVerifier verifies the runtime handlers through the CRI API of the runtime
+type criVerifier struct {
+	socket  string
+	timeout time.Duration
+}
+
+// NewCRIVerifier returns a verifier waiting up to timeout for the runtime serving
+// the CRI API on the socket to report the runtime handlers, and checking them
+// against the cgroup driver of the runtime
+func NewCRIVerifier(socket string, timeout time.Duration) HandlerVerifier {
+	return criVerifier{socket: socket, timeout: timeout}
+}
+
+func (v criVerifier) WaitForHandlers(ctx context.Context, handlers []cri.Handler) error {
+	client, err := cri.NewClient(v.socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	return client.WaitForHandlers(ctx, handlers, time.Second)
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NVIDIA/nvidia-container-toolkit/pkg/nvcdi/spec"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/artifact"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri"
+	"github.com/NVIDIA/k8s-kata-manager/internal/kata/transform"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/version"
+)
+
+// Install installs the artifacts of all runtime classes, adds the runtime classes to
+// the runtime config and restarts the runtime. It returns the runtime config files
+// whose settings had to be modified. Install is idempotent; the runtime is only
+// restarted if its config changed.
+//
+// Runtime classes are installed independently: the runtime classes which could be
+// installed are added to the runtime config even if others failed, in which case a
+// *RuntimeClassError is returned.
+func (m *Manager) Install(ctx context.Context) ([]string, error) {
+	if err := m.loadKernelModules(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load kernel modules: %w", err)
+	}
+
+	if m.cdi != nil {
+		if err := m.generateCDISpec(); err != nil {
+			return nil, fmt.Errorf("failed to generate CDI spec: %w", err)
+		}
+	}
+	runtimeConfig, err := m.loadRuntime()
+	if err != nil {
+		return nil, fmt.Errorf("error creating runtime config client: %w", err)
+	}
+
+	m.blobs, err = cache.New(filepath.Join(m.artifactsDir(), cache.DirName))
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	var handlers []cri.Handler
+	overheads := make(map[string]corev1.ResourceList)
+	failed := make(map[string]error)
+	for i := range m.config.RuntimeClasses {
+		// Defaults from the artifact manifest are applied to a copy, so that every
+		// reconcile picks up the annotations of the artifact the tag points to
+		rc := m.config.RuntimeClasses[i]
+		if err := m.installRuntimeClass(ctx, runtimeConfig, &rc); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			// The runtime config is left untouched for the runtime class, so that a
+			// runtime class installed by an earlier reconcile keeps working
+			m.setRuntimeClassState(rc.Name, StateFailed, err.Error())
+			failed[rc.Name] = err
+			continue
+		}
+		installed = append(installed, rc.Name)
+		handlers = append(handlers, cri.Handler{Name: rc.Name, SystemdCgroup: rc.Runtime.Cgroup.SystemdCgroup})
+		if rc.Overhead != nil && len(rc.Overhead.PodFixed) > 0 {
+			overheads[rc.Name] = rc.Overhead.PodFixed
+		}
+	}
+
+	m.pruneBlobCache()
+
+	modified, err := modifiedFiles(runtimeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := runtimeConfig.Save()
+	if err != nil {
+		return nil, fmt.Errorf("unable to flush config: %w", err)
+	}
+	if n == 0 {
+		klog.Infof("Removed empty config")
+	} else {
+		klog.Infof("Wrote updated config")
+	}
+
+	klog.Infof("Restarting runtime")
+	if err := runtimeConfig.Restart(ctx); err != nil {
+		err = rollback(ctx, runtimeConfig, fmt.Errorf("unable to restart runtime service: %w", err))
+		m.failRuntimeClasses(ctx, installed, err)
+		return nil, err
+	}
+	if err := m.verifyRuntimeHandlers(ctx, handlers); err != nil {
+		err = fmt.Errorf("unable to verify runtime handlers: %w", err)
+		// The runtime was not restarted, so there is no previous config to go back to
+		if !runtimeConfig.Unchanged() {
+			err = rollback(ctx, runtimeConfig, err)
+		}
+		m.failRuntimeClasses(ctx, installed, err)
+		return nil, err
+	}
+	klog.Info("runtime successfully restarted")
+
+	for _, name := range installed {
+		m.setRuntimeClassState(name, StateInstalled, "")
+	}
+	if err := m.labelRuntimeClasses(ctx, installed, true); err != nil {
+		return nil, fmt.Errorf("unable to label node: %w", err)
+	}
+	m.setRuntimeClassOverheads(ctx, installed, overheads)
+
+	if len(failed) > 0 {
+		return modified, &RuntimeClassError{Errors: failed}
+	}
+	return modified, nil
+}
+
+// installRuntimeClass installs the artifacts of a runtime class and adds it to the
+// runtime config
+func (m *Manager) installRuntimeClass(ctx context.Context, runtimeConfig runtime.Runtime, rc *api.RuntimeClass) error {
+	// Installed runtime classes are reconciled without changing their state
+	if m.runtimeClassState(rc.Name) != StateInstalled {
+		m.setRuntimeClassState(rc.Name, StatePulling, "")
+	}
+
+	creds, err := m.credentials.GetCredentials(ctx, *rc)
+	if err != nil {
+		return fmt.Errorf("error getting credentials: %w", err)
+	}
+
+	kataConfigPath, err := m.installArtifacts(ctx, rc, creds)
+	if err != nil {
+		return err
+	}
+
+	kataConfigPath, err = m.transformKataConfig(kataConfigPath)
+	if err != nil {
+		return fmt.Errorf("error transforming kata configuration file: %w", err)
+	}
+
+	err = runtimeConfig.AddRuntime(
+		rc.Name,
+		m.root.HostPath(kataConfigPath),
+		runtime.NewRuntimeClassOptions(rc),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %w", err)
+	}
+	return nil
+}
+
+// failRuntimeClasses marks runtime classes as failed after the runtime config had to
+// be rolled back, and removes their node labels so that kata pods are no longer
+// scheduled onto the node
+func (m *Manager) failRuntimeClasses(ctx context.Context, names []string, err error) {
+	for _, name := range names {
+		m.setRuntimeClassState(name, StateFailed, err.Error())
+	}
+	if err := m.labelRuntimeClasses(ctx, names, false); err != nil {
+		klog.Warningf("Unable to remove runtime class labels from node: %v", err)
+	}
+}
+
+// modifiedFiles returns the runtime config files whose settings are modified when
+// the runtime config is saved
+func modifiedFiles(runtimeConfig runtime.Runtime) ([]string, error) {
+	changes, err := runtimeConfig.Changes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine config changes: %w", err)
+	}
+	var modified []string
+	for _, c := range changes {
+		if c.Modified() {
+			modified = append(modified, c.Path)
+		}
+	}
+	return modified, nil
+}
+
+// installArtifacts pulls the artifacts of a runtime class into its artifacts directory
+// and returns the local path of the kata configuration file. Settings of the runtime
+// class which are not explicitly configured are defaulted from the artifact manifest.
+func (m *Manager) installArtifacts(ctx context.Context, rc *api.RuntimeClass, creds *auth.Credential) (string, error) {
+	rcDir := filepath.Join(m.artifactsDir(), rc.Name)
+	if _, err := os.Stat(rcDir); os.IsNotExist(err) {
+		err := os.Mkdir(rcDir, 0755)
+		if err != nil {
+			return "", fmt.Errorf("error creating artifact directory: %w", err)
+		}
+	}
+
+	manifest, err := m.resolveArtifact(ctx, rc, creds)
+	if err != nil {
+		return "", err
+	}
+
+	if err := artifact.CheckFreeSpace(rcDir, artifact.RequiredSpace(manifest, m.blobs)); err != nil {
+		return "", fmt.Errorf("unable to install runtime class %s: %w", rc.Name, err)
+	}
+
+	err = m.puller.Pull(ctx, rc.Artifacts.URL, rcDir, creds, manifest, m.blobs)
+	if err != nil {
+		return "", err
+	}
+
+	kataConfigPath, err := artifact.KataConfigPath(rcDir, rc.KataConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to install runtime class %s: %w", rc.Name, err)
+	}
+	return kataConfigPath, nil
+}
+
+// resolveArtifact fetches the manifest of the artifact of a runtime class and checks
+// that the artifact can be installed. Settings of the runtime class which are not
+// explicitly configured are defaulted from the artifact manifest.
+func (m *Manager) resolveArtifact(ctx context.Context, rc *api.RuntimeClass, creds *auth.Credential) (*ocispec.Manifest, error) {
+	manifest, err := m.puller.Manifest(ctx, rc.Artifacts.URL, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := artifact.Verify(manifest, version.Get(), m.root.Path("/"), m.config.MaxArtifactSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to install runtime class %s: %w", rc.Name, err)
+	}
+	metadata.ApplyDefaults(rc)
+
+	return manifest, nil
+}
+
+// pruneBlobCache removes blobs no longer used by any runtime class and reports the
+// disk space used by the blob cache
+func (m *Manager) pruneBlobCache() {
+	freed, err := m.blobs.Prune()
+	if err != nil {
+		klog.Warningf("Unable to prune blob cache: %v", err)
+	} else if freed > 0 {
+		klog.Infof("Pruned %d bytes of unused blobs from cache", freed)
+	}
+
+	usage, err := m.blobs.Usage()
+	if err != nil {
+		klog.Warningf("Unable to compute blob cache usage: %v", err)
+		return
+	}
+	klog.Infof("Blob cache holds %d blobs using %d bytes", usage.Blobs, usage.Bytes)
+}
+
+// transformKataConfig applies the transformer chain to the kata configuration file and
+// returns the path of the transformed copy. The pulled file is left untouched, as it
+// is linked into the blob cache. The artifacts root is the directory of the file on
+// the host.
+func (m *Manager) transformKataConfig(path string) (string, error) {
+	transformed := transformedKataConfigPath(path)
+	if err := transform.TransformFile(path, transformed, m.transformers(m.root.HostPath(filepath.Dir(path)))...); err != nil {
+		return "", err
+	}
+	return transformed, nil
+}
+
+// transformedKataConfigPath returns the path of the transformed copy of the kata
+// configuration file at path, which is referenced by the runtime config
+func transformedKataConfigPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".transformed" + ext
+}
+
+// generateCDISpec saves the CDI specification for all NVIDIA GPUs configured for
+// passthrough
+func (m *Manager) generateCDISpec() error {
+	klog.Info("Generating a CDI specification for all NVIDIA GPUs configured for passthrough")
+	spec, path, err := m.getCDISpec()
+	if err != nil {
+		return err
+	}
+
+	err = spec.Save(path)
+	if err != nil {
+		return fmt.Errorf("failed to save cdi spec: %w", err)
+	}
+
+	return nil
+}
+
+// getCDISpec returns the CDI specification and the local path it is saved to
+func (m *Manager) getCDISpec() (spec.Interface, string, error) {
+	spec, err := m.cdi.GetSpec()
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting cdi spec: %w", err)
+	}
+
+	specName, err := cdiapi.GenerateNameForSpec(spec.Raw())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate cdi spec name: %w", err)
+	}
+
+	return spec, filepath.Join(m.root.Path(m.cdiRoot), specName+".yaml"), nil
+}
+
+// verifyRuntimeHandlers waits until the runtime reports the handlers of the runtime
+// classes
+func (m *Manager) verifyRuntimeHandlers(ctx context.Context, handlers []cri.Handler) error {
+	if m.verifier == nil || len(handlers) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(handlers))
+	for _, h := range handlers {
+		names = append(names, h.Name)
+	}
+	klog.Infof("Waiting for runtime handlers %q to be registered", names)
+	return m.verifier.WaitForHandlers(ctx, handlers)
+}
+
+// labelRuntimeClasses labels the node with the runtime classes installed on it, or
+// removes the labels
+func (m *Manager) labelRuntimeClasses(ctx context.Context, names []string, installed bool) error {
+	if m.cluster == nil {
+		return nil
+	}
+
+	labels := make(map[string]*string)
+	for _, name := range names {
+		key := RuntimeClassLabelPrefix + name
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			klog.Warningf("Not labeling node for runtime class %s: %v", name, strings.Join(errs, "; "))
+			continue
+		}
+		labels[key] = nil
+		if installed {
+			value := "true"
+			labels[key] = &value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return m.cluster.LabelNode(ctx, labels)
+}
+
+// setRuntimeClassOverheads sets the pod overhead of the RuntimeClass objects of the
+// installed runtime classes which have one. Failing to set an overhead doesn't fail
+// the install, as the RuntimeClass objects are not managed by kata manager.
+func (m *Manager) setRuntimeClassOverheads(ctx context.Context, names []string, overheads map[string]corev1.ResourceList) {
+	for _, name := range names {
+		overhead, ok := overheads[name]
+		if !ok {
+			continue
+		}
+		klog.Infof("Recommended pod overhead for runtime class %s: %v", name, overhead)
+		if m.cluster == nil {
+			continue
+		}
+
+		err := m.cluster.SetRuntimeClassOverhead(ctx, name, overhead)
+		switch {
+		case err == nil:
+		case apierrors.IsNotFound(err):
+			klog.Infof("Not setting pod overhead of runtime class %s: RuntimeClass does not exist", name)
+		case apierrors.IsConflict(err):
+			klog.Warningf("Not setting pod overhead of runtime class %s: overhead is managed by another component: %v", name, err)
+		default:
+			klog.Warningf("Unable to set pod overhead of runtime class %s: %v", name, err)
+		}
+	}
+}
+
+// rollback restores the runtime config saved before the last update and restarts the
+// runtime with it, after the runtime failed to come up with the updated config. The
+// rollback is carried out even if the context has been canceled.
+func rollback(ctx context.Context, runtimeConfig runtime.Runtime, cause error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	klog.Errorf("Rolling back runtime config: %v", cause)
+	if err := runtimeConfig.Rollback(); err != nil {
+		return fmt.Errorf("%w; rollback failed: %v", cause, err)
+	}
+	if err := runtimeConfig.Restart(ctx); err != nil {
+		return fmt.Errorf("%w; restart after rollback failed: %v", cause, err)
+	}
+	klog.Info("Restored previous runtime config")
+	return cause
+}
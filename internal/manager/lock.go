@@ -0,0 +1,69 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// Lock takes an exclusive lock on the pid file in the artifacts directory, so that
+// only a single kata manager configures the node. The artifacts directory is created
+// on the host if it does not exist.
+func (m *Manager) Lock() error {
+	if err := os.MkdirAll(m.artifactsDir(), 0755); err != nil {
+		return fmt.Errorf("unable to create artifacts directory: %w", err)
+	}
+	path := filepath.Join(m.artifactsDir(), pidFileName)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create pidfile: %w", err)
+	}
+
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		f.Close()
+		klog.Warningf("Unable to get exclusive lock on '%v'", path)
+		klog.Warningf("This normally means an instance of the NVIDIA k8s-kata-manager Container is already running, aborting")
+		return fmt.Errorf("unable to get flock on pidfile: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "%v\n", os.Getpid())
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write PID to pidfile: %w", err)
+	}
+
+	m.pidFile = f
+	return nil
+}
+
+// Unlock releases the lock taken by Lock and removes the pid file
+func (m *Manager) Unlock() {
+	if m.pidFile == nil {
+		return
+	}
+	if err := os.Remove(m.pidFile.Name()); err != nil {
+		klog.Warningf("Unable to remove pidfile: %v", err)
+	}
+	m.pidFile.Close()
+	m.pidFile = nil
+}
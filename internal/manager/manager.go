@@ -0,0 +1,305 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/nvidia-container-toolkit/pkg/nvcdi/spec"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/kata/transform"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+)
+
+const (
+	// RuntimeClassLabelPrefix prefixes the node labels advertising the runtime classes
+	// installed on the node
+	RuntimeClassLabelPrefix = "kata.nvidia.com/"
+
+	// DefaultHostRoot is the path the host root filesystem is mounted at
+	DefaultHostRoot = "/host"
+	// DefaultCDIRoot is the directory on the host the CDI specification is saved to
+	DefaultCDIRoot = "/var/run/cdi"
+
+	// shutdownTimeout bounds the cleanup and rollback of the runtime config, which run
+	// after the context of the daemon has been canceled. The termination grace period
+	// of the pod must exceed it.
+	shutdownTimeout = 5 * time.Minute
+
+	pidFileName = "k8s-kata-manager.pid"
+)
+
+// Puller fetches the manifests of artifacts and pulls artifacts
+type Puller interface {
+	// Manifest resolves the artifact reference and fetches its manifest
+	Manifest(ctx context.Context, ref string, creds *auth.Credential) (*ocispec.Manifest, error)
+	// Pull pulls the layers described by the manifest into the directory, through
+	// the blob cache
+	Pull(ctx context.Context, ref string, dir string, creds *auth.Credential, manifest *ocispec.Manifest, blobs *cache.Cache) error
+}
+
+// CredentialsGetter returns the registry credentials of a runtime class
+type CredentialsGetter interface {
+	GetCredentials(ctx context.Context, rc api.RuntimeClass) (*auth.Credential, error)
+}
+
+// TransformerChain returns the transforms applied to the kata configuration file of
+// a runtime class whose artifacts are installed in artifactsRoot
+type TransformerChain func(artifactsRoot string) []transform.Transformer
+
+// RuntimeLoader loads the runtime config. It is called for every reconcile and
+// cleanup, so that changes made to the config in the meantime are picked up.
+type RuntimeLoader func() (runtime.Runtime, error)
+
+// CDISpecGetter returns the CDI specification of the devices of the node
+type CDISpecGetter interface {
+	GetSpec(...string) (spec.Interface, error)
+}
+
+// HandlerVerifier waits until the runtime reports the runtime handlers
+type HandlerVerifier interface {
+	WaitForHandlers(ctx context.Context, handlers []cri.Handler) error
+}
+
+// Cluster provides access to the node and the cluster state
+type Cluster interface {
+	GetNodeLabels(ctx context.Context) (map[string]string, error)
+	GetOwnerDaemonSet(ctx context.Context) (*appsv1.DaemonSet, error)
+	ListNodePods(ctx context.Context) ([]corev1.Pod, error)
+	LabelNode(ctx context.Context, labels map[string]*string) error
+	RecordNodeEvent(eventType string, reason string, message string)
+	// SetRuntimeClassOverhead sets the pod overhead of an existing RuntimeClass; it
+	// returns a not found error if the RuntimeClass doesn't exist and a conflict error
+	// if the overhead is managed by someone else
+	SetRuntimeClassOverhead(ctx context.Context, name string, overhead corev1.ResourceList) error
+}
+
+// Manager installs the runtime classes of its config on the node, keeps them
+// installed and removes them again
+type Manager struct {
+	config *api.Config
+
+	puller       Puller
+	credentials  CredentialsGetter
+	transformers TransformerChain
+	loadRuntime  RuntimeLoader
+	cdi          CDISpecGetter
+	executor     host.Executor
+	verifier     HandlerVerifier
+	cluster      Cluster
+	root         host.Root
+	cdiRoot      string
+	loadModules  bool
+
+	cleanupPolicy     string
+	reconcileInterval time.Duration
+	watchedFiles      []string
+	watchedDirs       []string
+	// watchedContent is the content of the watched files after the last reconcile,
+	// so that changes written by the manager itself are not repaired again
+	watchedContent map[string]string
+
+	blobs             *cache.Cache
+	pidFile           *os.File
+	reconcileRequests chan string
+	reconcileMu       sync.Mutex
+	status            reconcileStatus
+}
+
+// Option is a functional option for the manager
+type Option func(*Manager)
+
+// New creates a manager for the runtime classes of the config. A runtime loader
+// has to be set.
+func New(config *api.Config, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		config:            config,
+		root:              DefaultHostRoot,
+		cdiRoot:           DefaultCDIRoot,
+		cleanupPolicy:     CleanupOnUninstall,
+		reconcileRequests: make(chan string, 1),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.status.classes = make(map[string]RuntimeClassStatus)
+	for _, rc := range config.RuntimeClasses {
+		m.status.classes[rc.Name] = RuntimeClassStatus{State: StatePending, Since: time.Now()}
+	}
+
+	if m.loadRuntime == nil {
+		return nil, fmt.Errorf("no runtime loader set")
+	}
+	switch m.cleanupPolicy {
+	case CleanupOnUninstall, CleanupAlways, CleanupNever:
+	default:
+		return nil, fmt.Errorf("unsupported cleanup policy %q", m.cleanupPolicy)
+	}
+
+	if m.puller == nil {
+		m.puller = orasPuller{}
+	}
+	if m.credentials == nil {
+		m.credentials = anonymous{}
+	}
+	if m.transformers == nil {
+		m.transformers = DefaultTransformers
+	}
+	if m.executor == nil {
+		m.executor = host.NewExecutor(m.root)
+	}
+
+	return m, nil
+}
+
+// WithPuller sets the puller of the artifacts. Artifacts are pulled with ORAS by
+// default.
+func WithPuller(puller Puller) Option {
+	return func(m *Manager) {
+		m.puller = puller
+	}
+}
+
+// WithCredentials sets the getter of the registry credentials. Artifacts are pulled
+// anonymously by default.
+func WithCredentials(credentials CredentialsGetter) Option {
+	return func(m *Manager) {
+		m.credentials = credentials
+	}
+}
+
+// WithTransformers sets the transforms applied to kata configuration files
+func WithTransformers(transformers TransformerChain) Option {
+	return func(m *Manager) {
+		m.transformers = transformers
+	}
+}
+
+// WithRuntime sets the loader of the runtime config
+func WithRuntime(loadRuntime RuntimeLoader) Option {
+	return func(m *Manager) {
+		m.loadRuntime = loadRuntime
+	}
+}
+
+// WithCDI enables the generation of a CDI specification with the getter
+func WithCDI(cdi CDISpecGetter) Option {
+	return func(m *Manager) {
+		m.cdi = cdi
+	}
+}
+
+// WithCDIRoot sets the directory on the host the CDI specification is saved to
+func WithCDIRoot(cdiRoot string) Option {
+	return func(m *Manager) {
+		m.cdiRoot = cdiRoot
+	}
+}
+
+// WithHostExecutor sets the executor of operations on the host. Operations are run
+// in the mount namespace of the host by default.
+func WithHostExecutor(executor host.Executor) Option {
+	return func(m *Manager) {
+		m.executor = executor
+	}
+}
+
+// WithHostRoot sets the path the host root filesystem is mounted at. The artifacts
+// directory, the CDI directory and sysfs are paths on the host resolved against it.
+func WithHostRoot(hostRoot string) Option {
+	return func(m *Manager) {
+		m.root = host.Root(hostRoot)
+	}
+}
+
+// WithHandlerVerifier sets the verifier of the runtime handlers after a restart of
+// the runtime. Runtime handlers are not verified if unset.
+func WithHandlerVerifier(verifier HandlerVerifier) Option {
+	return func(m *Manager) {
+		m.verifier = verifier
+	}
+}
+
+// WithCluster sets the client of the cluster. Without it, the node is not labeled,
+// no events are recorded and the on-uninstall cleanup policy keeps the config.
+func WithCluster(cluster Cluster) Option {
+	return func(m *Manager) {
+		m.cluster = cluster
+	}
+}
+
+// WithLoadKernelModules sets whether the kernel modules of the config are loaded on
+// the host before installing
+func WithLoadKernelModules(load bool) Option {
+	return func(m *Manager) {
+		m.loadModules = load
+	}
+}
+
+// WithCleanupPolicy sets when the runtime config is removed on termination
+func WithCleanupPolicy(policy string) Option {
+	return func(m *Manager) {
+		m.cleanupPolicy = policy
+	}
+}
+
+// WithReconcileInterval sets the interval of periodic reconciles. Periodic
+// reconciles are disabled if zero.
+func WithReconcileInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.reconcileInterval = interval
+	}
+}
+
+// DefaultTransformers points the artifact paths of the kata configuration file to
+// the artifacts root
+func DefaultTransformers(artifactsRoot string) []transform.Transformer {
+	return []transform.Transformer{transform.NewArtifactsRootTransformer(artifactsRoot)}
+}
+
+// BackupDir returns the directory in which the original runtime configs are backed
+// up for the artifacts directory
+func BackupDir(artifactsDir string) string {
+	return filepath.Join(artifactsDir, backup.DirName)
+}
+
+// artifactsDir returns the local path of the artifacts directory
+func (m *Manager) artifactsDir() string {
+	return m.root.Path(m.config.ArtifactsDir)
+}
+
+// anonymous pulls artifacts without credentials
+type anonymous struct{}
+
+func (anonymous) GetCredentials(context.Context, api.RuntimeClass) (*auth.Credential, error) {
+	return nil, nil
+}
@@ -0,0 +1,1090 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/nvidia-container-toolkit/pkg/nvcdi/spec"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	specs "tags.cncf.io/container-device-interface/specs-go"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri"
+	"github.com/NVIDIA/k8s-kata-manager/internal/dryrun"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host/fake"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+)
+
+const testKataConfig = `[hypervisor.qemu]
+kernel = "/opt/kata/share/kata-containers/vmlinux.container"
+image = "/opt/kata/share/kata-containers/kata-containers.img"
+`
+
+// fakePuller serves artifacts holding a kata configuration file
+type fakePuller struct {
+	// errors are returned for the artifact references
+	errors map[string]error
+}
+
+func (p *fakePuller) files() map[string]string {
+	return map[string]string{
+		"configuration-kata-qemu.toml": testKataConfig,
+		"vmlinux.container":            "kernel",
+	}
+}
+
+func (p *fakePuller) Manifest(_ context.Context, ref string, _ *auth.Credential) (*ocispec.Manifest, error) {
+	if err := p.errors[ref]; err != nil {
+		return nil, err
+	}
+	manifest := &ocispec.Manifest{}
+	for name, content := range p.files() {
+		manifest.Layers = append(manifest.Layers, ocispec.Descriptor{
+			MediaType:   "application/octet-stream",
+			Digest:      digest.FromString(content),
+			Size:        int64(len(content)),
+			Annotations: map[string]string{ocispec.AnnotationTitle: name},
+		})
+	}
+	return manifest, nil
+}
+
+func (p *fakePuller) Pull(_ context.Context, _ string, dir string, _ *auth.Credential, _ *ocispec.Manifest, _ *cache.Cache) error {
+	for name, content := range p.files() {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fakeRuntime records the runtime config in memory, and writes it to path if set
+type fakeRuntime struct {
+	path       string
+	runtimes   map[string]string
+	saved      *string
+	unchanged  bool
+	saves      int
+	restarts   int
+	rollbacks  int
+	restartErr error
+}
+
+func (r *fakeRuntime) AddRuntime(name string, path string, _ runtime.RuntimeClassOptions) error {
+	if r.runtimes == nil {
+		r.runtimes = make(map[string]string)
+	}
+	r.runtimes[name] = path
+	return nil
+}
+
+func (r *fakeRuntime) DefaultRuntime() string {
+	return ""
+}
+
+func (r *fakeRuntime) RemoveRuntime(name string) error {
+	delete(r.runtimes, name)
+	return nil
+}
+
+func (r *fakeRuntime) Save() (int64, error) {
+	r.saves++
+	content := r.render()
+	r.unchanged = r.saved != nil && *r.saved == content
+	r.saved = &content
+	return int64(len(r.runtimes)), r.write()
+}
+
+func (r *fakeRuntime) Unchanged() bool {
+	return r.unchanged
+}
+
+func (r *fakeRuntime) Restart(context.Context) error {
+	if r.unchanged {
+		return nil
+	}
+	r.restarts++
+	// Only the first restart fails, so that the rollback succeeds
+	err := r.restartErr
+	r.restartErr = nil
+	return err
+}
+
+func (r *fakeRuntime) Rollback() error {
+	r.rollbacks++
+	r.runtimes = nil
+	r.saved = nil
+	r.unchanged = false
+	return r.write()
+}
+
+// render returns the names of the runtimes as the content of the config file
+func (r *fakeRuntime) render() string {
+	var names []string
+	for name := range r.runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n")
+}
+
+// write writes the config file, if any
+func (r *fakeRuntime) write() error {
+	if r.path == "" {
+		return nil
+	}
+	return os.WriteFile(r.path, []byte(r.render()), 0644)
+}
+
+func (r *fakeRuntime) Changes() ([]runtime.FileChange, error) {
+	return nil, nil
+}
+
+type fakeVerifier struct {
+	err error
+}
+
+func (v *fakeVerifier) WaitForHandlers(context.Context, []cri.Handler) error {
+	return v.err
+}
+
+type fakeCDI struct{}
+
+func (fakeCDI) GetSpec(...string) (spec.Interface, error) {
+	return spec.New(
+		spec.WithVendor("nvidia.com"),
+		spec.WithClass("pgpu"),
+		spec.WithDeviceSpecs([]specs.Device{
+			{
+				Name:           "0",
+				ContainerEdits: specs.ContainerEdits{DeviceNodes: []*specs.DeviceNode{{Path: "/dev/vfio/1"}}},
+			},
+		}),
+	)
+}
+
+// fakeCluster holds the state of the node and the kata manager DaemonSet
+type fakeCluster struct {
+	sync.Mutex
+	nodeLabels map[string]string
+	daemonSet  *appsv1.DaemonSet
+	pods       []corev1.Pod
+	events     []string
+	overheads  map[string]corev1.ResourceList
+	// overheadErrors are returned when setting the overhead of the RuntimeClasses
+	overheadErrors map[string]error
+}
+
+func (c *fakeCluster) GetNodeLabels(context.Context) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.nodeLabels, nil
+}
+
+func (c *fakeCluster) GetOwnerDaemonSet(context.Context) (*appsv1.DaemonSet, error) {
+	return c.daemonSet, nil
+}
+
+func (c *fakeCluster) ListNodePods(context.Context) ([]corev1.Pod, error) {
+	return c.pods, nil
+}
+
+func (c *fakeCluster) LabelNode(_ context.Context, labels map[string]*string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.nodeLabels == nil {
+		c.nodeLabels = make(map[string]string)
+	}
+	for key, value := range labels {
+		if value == nil {
+			delete(c.nodeLabels, key)
+			continue
+		}
+		c.nodeLabels[key] = *value
+	}
+	return nil
+}
+
+func (c *fakeCluster) RecordNodeEvent(_ string, reason string, _ string) {
+	c.Lock()
+	defer c.Unlock()
+	c.events = append(c.events, reason)
+}
+
+func (c *fakeCluster) SetRuntimeClassOverhead(_ context.Context, name string, overhead corev1.ResourceList) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.overheadErrors[name]; err != nil {
+		return err
+	}
+	if c.overheads == nil {
+		c.overheads = make(map[string]corev1.ResourceList)
+	}
+	c.overheads[name] = overhead
+	return nil
+}
+
+// fixture holds the fakes a manager is created with
+type fixture struct {
+	t        *testing.T
+	config   *api.Config
+	hostRoot host.Root
+	puller   *fakePuller
+	runtime  *fakeRuntime
+	executor *fake.Executor
+	verifier *fakeVerifier
+	cluster  *fakeCluster
+}
+
+// newFixture returns the fakes for a manager installing the runtime classes on a
+// fake host tree
+func newFixture(t *testing.T, runtimeClasses ...string) *fixture {
+	hostRoot := host.Root(t.TempDir())
+	config := api.NewDefaultConfig()
+	require.NoError(t, os.MkdirAll(hostRoot.Path(config.ArtifactsDir), 0755))
+	config.RuntimeClasses = nil
+	for _, name := range runtimeClasses {
+		config.RuntimeClasses = append(config.RuntimeClasses, api.RuntimeClass{
+			Name:      name,
+			Artifacts: api.Artifacts{URL: "registry.example.com/kata/" + name + ":latest"},
+		})
+	}
+
+	return &fixture{
+		t:        t,
+		config:   config,
+		hostRoot: hostRoot,
+		puller:   &fakePuller{},
+		runtime:  &fakeRuntime{},
+		executor: &fake.Executor{},
+		verifier: &fakeVerifier{},
+		cluster:  &fakeCluster{},
+	}
+}
+
+func (f *fixture) manager(t *testing.T, opts ...Option) *Manager {
+	opts = append([]Option{
+		WithPuller(f.puller),
+		WithRuntime(func() (runtime.Runtime, error) { return f.runtime, nil }),
+		WithHostRoot(string(f.hostRoot)),
+		WithHostExecutor(f.executor),
+		WithHandlerVerifier(f.verifier),
+		WithCluster(f.cluster),
+	}, opts...)
+	m, err := New(f.config, opts...)
+	require.NoError(t, err)
+	return m
+}
+
+// writeHostFile writes a file of the fake host tree
+func (f *fixture) writeHostFile(path string, content string) {
+	path = f.hostRoot.Path(path)
+	require.NoError(f.t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(f.t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// loadedModules adds the kernel modules to the sysfs of the fake host tree
+func (f *fixture) loadedModules(modules ...string) {
+	for _, module := range modules {
+		require.NoError(f.t, os.MkdirAll(f.hostRoot.Path(filepath.Join(sysModuleDir, sysfsModuleName(module))), 0755))
+	}
+}
+
+// modprobeLoads makes loading the kernel modules with modprobe add them to the
+// sysfs of the fake host tree
+func (f *fixture) modprobeLoads(modules ...string) {
+	f.executor.Hooks = make(map[string]func())
+	for _, module := range modules {
+		f.executor.Hooks["modprobe "+module] = func() { f.loadedModules(module) }
+	}
+}
+
+func TestNew(t *testing.T) {
+	config := api.NewDefaultConfig()
+	loadRuntime := func() (runtime.Runtime, error) { return &fakeRuntime{}, nil }
+
+	_, err := New(config, WithRuntime(loadRuntime))
+	require.NoError(t, err)
+
+	_, err = New(config)
+	require.ErrorContains(t, err, "no runtime loader")
+
+	_, err = New(config, WithRuntime(loadRuntime), WithCleanupPolicy("sometimes"))
+	require.ErrorContains(t, err, "unsupported cleanup policy")
+}
+
+func TestInstall(t *testing.T) {
+	testCases := []struct {
+		description string
+		setup       func(f *fixture)
+		options     []Option
+		// expectedError is a substring of the expected error, if any
+		expectedError     string
+		expectedRuntimes  []string
+		expectedSaves     int
+		expectedRestarts  int
+		expectedRollbacks int
+		expectedCommands  []string
+		expectedLabels    map[string]string
+		expectedStates    map[string]RuntimeClassState
+		expectedEvents    []string
+	}{
+		{
+			description:      "installs all runtime classes",
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "loads kernel modules",
+			setup: func(f *fixture) {
+				f.modprobeLoads("vhost-vsock", "vhost-net")
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedCommands: []string{"modprobe vhost-vsock", "modprobe vhost-net"},
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "loads kernel modules with parameters",
+			setup: func(f *fixture) {
+				f.config.KernelModules = []api.KernelModule{
+					{Name: "vfio-pci", Parameters: []string{"ids=10de:2331", "disable_idle_d3=1"}},
+				}
+				f.executor.Hooks = map[string]func(){
+					"modprobe vfio-pci ids=10de:2331 disable_idle_d3=1": func() { f.loadedModules("vfio-pci") },
+				}
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedCommands: []string{"modprobe vfio-pci ids=10de:2331 disable_idle_d3=1"},
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "kernel modules already loaded",
+			setup: func(f *fixture) {
+				f.loadedModules("vhost-vsock", "vhost-net")
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "built-in kernel modules",
+			setup: func(f *fixture) {
+				f.writeHostFile(kernelReleaseFile, "6.8.0-40-generic\n")
+				f.writeHostFile("/lib/modules/6.8.0-40-generic/modules.builtin", "kernel/drivers/vhost/vhost_vsock.ko\nkernel/drivers/vhost/vhost_net.ko\n")
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedCommands: []string{"modprobe vhost-vsock", "modprobe vhost-net"},
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "kernel module unavailable",
+			setup: func(f *fixture) {
+				f.writeHostFile(kernelReleaseFile, "6.8.0-40-generic\n")
+				f.executor.Errors = map[string]error{"modprobe vhost-vsock": &host.CommandError{
+					Operation: host.Modprobe,
+					Args:      []string{"vhost-vsock"},
+					ExitCode:  1,
+					Stderr:    "modprobe: FATAL: Module vhost-vsock not found in directory /lib/modules/6.8.0-40-generic",
+					Err:       fmt.Errorf("exit status 1"),
+				}}
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedError:    "failed to load module vhost-vsock: kernel module vhost-vsock is not available in the host kernel 6.8.0-40-generic",
+			expectedCommands: []string{"modprobe vhost-vsock"},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StatePending,
+				"kata-qemu-nvidia-gpu": StatePending,
+			},
+		},
+		{
+			description: "optional kernel module unavailable",
+			setup: func(f *fixture) {
+				f.config.KernelModules = []api.KernelModule{
+					{Name: "kvm_amd", Optional: true},
+					{Name: "kvm_intel", Optional: true},
+				}
+				f.executor.Errors = map[string]error{"modprobe kvm_amd": &host.CommandError{
+					Operation: host.Modprobe,
+					Args:      []string{"kvm_amd"},
+					ExitCode:  1,
+					Stderr:    "modprobe: ERROR: could not insert 'kvm_amd': Module not found",
+					Err:       fmt.Errorf("exit status 1"),
+				}}
+				f.modprobeLoads("kvm_intel")
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedRuntimes: []string{"kata-qemu", "kata-qemu-nvidia-gpu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedCommands: []string{"modprobe kvm_amd", "modprobe kvm_intel"},
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateInstalled,
+			},
+			expectedEvents: []string{"RuntimeClassInstalled", "RuntimeClassInstalled"},
+		},
+		{
+			description: "kernel module fails to load",
+			setup: func(f *fixture) {
+				f.executor.Errors = map[string]error{"modprobe vhost-vsock": fmt.Errorf("operation not permitted")}
+			},
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedError:    "failed to load module vhost-vsock: operation not permitted",
+			expectedCommands: []string{"modprobe vhost-vsock"},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StatePending,
+				"kata-qemu-nvidia-gpu": StatePending,
+			},
+		},
+		{
+			description:      "kernel module missing after loading",
+			options:          []Option{WithLoadKernelModules(true)},
+			expectedError:    "failed to load module vhost-vsock: module not found in /sys/module after loading it",
+			expectedCommands: []string{"modprobe vhost-vsock"},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StatePending,
+				"kata-qemu-nvidia-gpu": StatePending,
+			},
+		},
+		{
+			description: "artifact unreachable",
+			setup: func(f *fixture) {
+				f.puller.errors = map[string]error{
+					"registry.example.com/kata/kata-qemu-nvidia-gpu:latest": fmt.Errorf("connection refused"),
+				}
+			},
+			expectedError:    "runtime class kata-qemu-nvidia-gpu: connection refused",
+			expectedRuntimes: []string{"kata-qemu"},
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedLabels: map[string]string{
+				"kata.nvidia.com/kata-qemu": "true",
+			},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateInstalled,
+				"kata-qemu-nvidia-gpu": StateFailed,
+			},
+			expectedEvents: []string{"RuntimeClassFailed", "RuntimeClassInstalled"},
+		},
+		{
+			description: "all artifacts unreachable",
+			setup: func(f *fixture) {
+				f.puller.errors = map[string]error{
+					"registry.example.com/kata/kata-qemu:latest":            fmt.Errorf("connection refused"),
+					"registry.example.com/kata/kata-qemu-nvidia-gpu:latest": fmt.Errorf("connection refused"),
+				}
+			},
+			expectedError:    "runtime class kata-qemu: connection refused; runtime class kata-qemu-nvidia-gpu: connection refused",
+			expectedSaves:    1,
+			expectedRestarts: 1,
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateFailed,
+				"kata-qemu-nvidia-gpu": StateFailed,
+			},
+			expectedEvents: []string{"RuntimeClassFailed", "RuntimeClassFailed"},
+		},
+		{
+			description: "runtime fails to restart",
+			setup: func(f *fixture) {
+				f.runtime.restartErr = fmt.Errorf("containerd exited")
+			},
+			expectedError:     "unable to restart runtime service",
+			expectedSaves:     1,
+			expectedRestarts:  2,
+			expectedRollbacks: 1,
+			expectedLabels:    map[string]string{},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateFailed,
+				"kata-qemu-nvidia-gpu": StateFailed,
+			},
+			expectedEvents: []string{"RuntimeClassFailed", "RuntimeClassFailed"},
+		},
+		{
+			description: "runtime handlers missing",
+			setup: func(f *fixture) {
+				f.verifier.err = fmt.Errorf("handler kata-qemu missing")
+			},
+			expectedError:     "unable to verify runtime handlers",
+			expectedSaves:     1,
+			expectedRestarts:  2,
+			expectedRollbacks: 1,
+			expectedLabels:    map[string]string{},
+			expectedStates: map[string]RuntimeClassState{
+				"kata-qemu":            StateFailed,
+				"kata-qemu-nvidia-gpu": StateFailed,
+			},
+			expectedEvents: []string{"RuntimeClassFailed", "RuntimeClassFailed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newFixture(t, "kata-qemu", "kata-qemu-nvidia-gpu")
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+			m := f.manager(t, tc.options...)
+
+			_, err := m.Install(context.Background())
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var runtimes []string
+			for name, path := range f.runtime.runtimes {
+				require.Equal(t, filepath.Join(f.config.ArtifactsDir, name, "configuration-kata-qemu.transformed.toml"), path)
+				runtimes = append(runtimes, name)
+			}
+			sort.Strings(runtimes)
+			require.Equal(t, tc.expectedRuntimes, runtimes)
+			require.Equal(t, tc.expectedSaves, f.runtime.saves)
+			require.Equal(t, tc.expectedRestarts, f.runtime.restarts)
+			require.Equal(t, tc.expectedRollbacks, f.runtime.rollbacks)
+			require.Equal(t, tc.expectedCommands, f.executor.Calls)
+			require.Equal(t, tc.expectedLabels, f.cluster.nodeLabels)
+
+			states := make(map[string]RuntimeClassState)
+			for name, status := range m.RuntimeClasses() {
+				states[name] = status.State
+			}
+			require.Equal(t, tc.expectedStates, states)
+			sort.Strings(f.cluster.events)
+			require.Equal(t, tc.expectedEvents, f.cluster.events)
+		})
+	}
+}
+
+func TestInstallSetsRuntimeClassOverhead(t *testing.T) {
+	f := newFixture(t, "kata-qemu", "kata-qemu-nvidia-gpu")
+	overhead := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("250m"),
+		corev1.ResourceMemory: resource.MustParse("160Mi"),
+	}
+	f.config.RuntimeClasses[1].Overhead = &api.Overhead{PodFixed: overhead}
+	m := f.manager(t)
+
+	_, err := m.Install(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]corev1.ResourceList{"kata-qemu-nvidia-gpu": overhead}, f.cluster.overheads)
+}
+
+func TestInstallSkipsRuntimeClassOverhead(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+	}{
+		{
+			description: "missing RuntimeClass",
+			err:         apierrors.NewNotFound(nodev1.Resource("runtimeclasses"), "kata-qemu"),
+		},
+		{
+			description: "overhead managed by another component",
+			err:         apierrors.NewConflict(nodev1.Resource("runtimeclasses"), "kata-qemu", fmt.Errorf("conflict with gpu-operator")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newFixture(t, "kata-qemu")
+			f.config.RuntimeClasses[0].Overhead = &api.Overhead{PodFixed: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("250m"),
+			}}
+			f.cluster.overheadErrors = map[string]error{"kata-qemu": tc.err}
+			m := f.manager(t)
+
+			_, err := m.Install(context.Background())
+			require.NoError(t, err)
+			require.Empty(t, f.cluster.overheads)
+			require.Equal(t, StateInstalled, m.RuntimeClasses()["kata-qemu"].State)
+		})
+	}
+}
+
+func TestInstallTransformsKataConfig(t *testing.T) {
+	f := newFixture(t, "kata-qemu")
+	m := f.manager(t)
+
+	_, err := m.Install(context.Background())
+	require.NoError(t, err)
+
+	// The artifact paths in the kata config are paths on the host
+	rcDir := filepath.Join(f.config.ArtifactsDir, "kata-qemu")
+	transformed := filepath.Join(rcDir, "configuration-kata-qemu.transformed.toml")
+	require.Equal(t, transformed, f.runtime.runtimes["kata-qemu"])
+	content, err := os.ReadFile(f.hostRoot.Path(transformed))
+	require.NoError(t, err)
+	require.Contains(t, string(content), fmt.Sprintf("kernel = %q", filepath.Join(rcDir, "vmlinux.container")))
+	require.Contains(t, string(content), fmt.Sprintf("image = %q", filepath.Join(rcDir, "kata-containers.img")))
+
+	// The pulled kata config is left untouched, so its blob stays cached
+	content, err = os.ReadFile(f.hostRoot.Path(filepath.Join(rcDir, "configuration-kata-qemu.toml")))
+	require.NoError(t, err)
+	require.Equal(t, testKataConfig, string(content))
+}
+
+func TestInstallGeneratesCDISpec(t *testing.T) {
+	f := newFixture(t, "kata-qemu")
+	cdiRoot := f.hostRoot.Path(DefaultCDIRoot)
+	require.NoError(t, os.MkdirAll(cdiRoot, 0755))
+	m := f.manager(t, WithCDI(fakeCDI{}))
+
+	_, err := m.Install(context.Background())
+	require.NoError(t, err)
+
+	specs, err := filepath.Glob(filepath.Join(cdiRoot, "*.yaml"))
+	require.NoError(t, err)
+	require.Len(t, specs, 1)
+}
+
+func TestInstallPersistsKernelModules(t *testing.T) {
+	f := newFixture(t, "kata-qemu")
+	f.config.KernelModules = []api.KernelModule{
+		{Name: "vhost-vsock", Persist: true},
+		{Name: "vhost-net"},
+		{Name: "vfio-pci", Parameters: []string{"ids=10de:2331"}, Persist: true},
+	}
+	f.loadedModules("vhost-vsock", "vhost-net", "vfio-pci")
+	m := f.manager(t, WithLoadKernelModules(true))
+
+	_, err := m.Install(context.Background())
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(f.hostRoot.Path(modulesLoadFile))
+	require.NoError(t, err)
+	require.Equal(t, persistedFileHeader+"vhost-vsock\nvfio-pci\n", string(content))
+	content, err = os.ReadFile(f.hostRoot.Path(modprobeOptionsFile))
+	require.NoError(t, err)
+	require.Equal(t, persistedFileHeader+"options vfio-pci ids=10de:2331\n", string(content))
+
+	// Files no longer needed are removed
+	f.config.KernelModules[2].Persist = false
+	_, err = m.Install(context.Background())
+	require.NoError(t, err)
+
+	content, err = os.ReadFile(f.hostRoot.Path(modulesLoadFile))
+	require.NoError(t, err)
+	require.Equal(t, persistedFileHeader+"vhost-vsock\n", string(content))
+	require.NoFileExists(t, f.hostRoot.Path(modprobeOptionsFile))
+}
+
+func TestDryRunKernelModules(t *testing.T) {
+	f := newFixture(t)
+	f.config.KernelModules = []api.KernelModule{
+		{Name: "vhost-vsock", Persist: true},
+		{Name: "kvm_amd", Optional: true, Persist: true},
+		{Name: "kvm_intel", Optional: true, Persist: true},
+	}
+	f.writeHostFile(kernelReleaseFile, "6.8.0-40-generic\n")
+	f.writeHostFile("/lib/modules/6.8.0-40-generic/modules.dep", "kernel/arch/x86/kvm/kvm-intel.ko.zst: kernel/arch/x86/kvm/kvm.ko.zst\n")
+	m := f.manager(t, WithLoadKernelModules(true))
+
+	plan, err := m.DryRun(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"vhost-vsock", "kvm_intel"}, plan.KernelModules)
+	require.Len(t, plan.Files, 1)
+	require.Equal(t, modulesLoadFile, plan.Files[0].Path)
+	require.Equal(t, dryrun.Create, plan.Files[0].Action)
+	require.Empty(t, f.executor.Calls)
+	require.NoFileExists(t, f.hostRoot.Path(modulesLoadFile))
+
+	var diff strings.Builder
+	require.NoError(t, plan.WriteDiff(&diff))
+	require.Contains(t, diff.String(), "+vhost-vsock\n+kvm_intel\n")
+}
+
+func TestCleanUp(t *testing.T) {
+	testCases := []struct {
+		description       string
+		restartErr        error
+		expectedError     string
+		expectedRuntimes  map[string]string
+		expectedRollbacks int
+	}{
+		{
+			description:      "removes runtime classes",
+			expectedRuntimes: map[string]string{"runc": "/usr/bin/runc"},
+		},
+		{
+			description:       "runtime fails to restart",
+			restartErr:        fmt.Errorf("containerd exited"),
+			expectedError:     "unable to restart runtime service",
+			expectedRollbacks: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newFixture(t, "kata-qemu", "kata-qemu-nvidia-gpu")
+			f.runtime.runtimes = map[string]string{
+				"runc":                 "/usr/bin/runc",
+				"kata-qemu":            "/opt/kata/kata-qemu/configuration-kata-qemu.toml",
+				"kata-qemu-nvidia-gpu": "/opt/kata/kata-qemu-nvidia-gpu/configuration-kata-qemu.toml",
+			}
+			f.runtime.restartErr = tc.restartErr
+			f.cluster.nodeLabels = map[string]string{
+				"kata.nvidia.com/kata-qemu":            "true",
+				"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+			}
+			f.writeHostFile(modulesLoadFile, persistedFileHeader+"vfio-pci\n")
+			f.writeHostFile(modprobeOptionsFile, persistedFileHeader+"options vfio-pci ids=10de:2331\n")
+			m := f.manager(t)
+
+			err := m.CleanUp(context.Background())
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectedRuntimes, f.runtime.runtimes)
+			require.Equal(t, 1, f.runtime.saves)
+			require.Equal(t, tc.expectedRollbacks, f.runtime.rollbacks)
+			require.Empty(t, f.cluster.nodeLabels)
+			if tc.expectedError == "" {
+				require.Equal(t, StateRemoved, m.RuntimeClasses()["kata-qemu"].State)
+				require.NoFileExists(t, f.hostRoot.Path(modulesLoadFile))
+				require.NoFileExists(t, f.hostRoot.Path(modprobeOptionsFile))
+			} else {
+				require.FileExists(t, f.hostRoot.Path(modulesLoadFile))
+				require.FileExists(t, f.hostRoot.Path(modprobeOptionsFile))
+			}
+		})
+	}
+}
+
+func TestShouldCleanUp(t *testing.T) {
+	kataQemu := "kata-qemu"
+	deleted := metav1.Now()
+
+	testCases := []struct {
+		description string
+		policy      string
+		cluster     *fakeCluster
+		expected    bool
+	}{
+		{
+			description: "never",
+			policy:      CleanupNever,
+			cluster:     &fakeCluster{},
+		},
+		{
+			description: "always",
+			policy:      CleanupAlways,
+			cluster:     &fakeCluster{daemonSet: &appsv1.DaemonSet{}},
+			expected:    true,
+		},
+		{
+			description: "always with kata pods running",
+			policy:      CleanupAlways,
+			cluster: &fakeCluster{pods: []corev1.Pod{
+				{Spec: corev1.PodSpec{RuntimeClassName: &kataQemu}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			}},
+		},
+		{
+			description: "on-uninstall with pod restarting",
+			policy:      CleanupOnUninstall,
+			cluster:     &fakeCluster{daemonSet: &appsv1.DaemonSet{}},
+		},
+		{
+			description: "on-uninstall with DaemonSet deleted",
+			policy:      CleanupOnUninstall,
+			cluster:     &fakeCluster{},
+			expected:    true,
+		},
+		{
+			description: "on-uninstall with DaemonSet being deleted",
+			policy:      CleanupOnUninstall,
+			cluster:     &fakeCluster{daemonSet: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deleted}}},
+			expected:    true,
+		},
+		{
+			description: "on-uninstall with uninstall annotation",
+			policy:      CleanupOnUninstall,
+			cluster: &fakeCluster{daemonSet: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{UninstallAnnotation: "true"},
+			}}},
+			expected: true,
+		},
+		{
+			description: "on-uninstall with node opted out",
+			policy:      CleanupOnUninstall,
+			cluster: &fakeCluster{
+				nodeLabels: map[string]string{OptOutLabel: "false"},
+				daemonSet:  &appsv1.DaemonSet{},
+			},
+			expected: true,
+		},
+		{
+			description: "on-uninstall with terminated kata pods",
+			policy:      CleanupOnUninstall,
+			cluster: &fakeCluster{pods: []corev1.Pod{
+				{Spec: corev1.PodSpec{RuntimeClassName: &kataQemu}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+			}},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newFixture(t, "kata-qemu")
+			f.cluster = tc.cluster
+			m := f.manager(t, WithCleanupPolicy(tc.policy))
+			require.Equal(t, tc.expected, m.ShouldCleanUp(context.Background()))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		description      string
+		policy           string
+		pullErrors       map[string]error
+		expectedRuntimes []string
+	}{
+		{
+			description:      "keeps runtime classes on restart",
+			policy:           CleanupOnUninstall,
+			expectedRuntimes: []string{"kata-qemu"},
+		},
+		{
+			description: "keeps running when runtime classes fail",
+			policy:      CleanupOnUninstall,
+			pullErrors: map[string]error{
+				"registry.example.com/kata/kata-qemu:latest": fmt.Errorf("connection refused"),
+			},
+		},
+		{
+			description: "removes runtime classes on termination",
+			policy:      CleanupAlways,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := newFixture(t, "kata-qemu")
+			f.cluster.daemonSet = &appsv1.DaemonSet{}
+			f.puller.errors = tc.pullErrors
+			m := f.manager(t, WithCleanupPolicy(tc.policy))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- m.Run(ctx)
+			}()
+			require.Eventually(t, func() bool {
+				m.status.Lock()
+				defer m.status.Unlock()
+				return m.status.last != nil
+			}, 10*time.Second, 10*time.Millisecond)
+			cancel()
+			require.NoError(t, <-done)
+
+			var runtimes []string
+			for name := range f.runtime.runtimes {
+				runtimes = append(runtimes, name)
+			}
+			require.Equal(t, tc.expectedRuntimes, runtimes)
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	f := newFixture(t)
+	m := f.manager(t)
+	other := f.manager(t)
+
+	require.NoError(t, m.Lock())
+	require.Error(t, other.Lock())
+
+	m.Unlock()
+	require.NoFileExists(t, f.hostRoot.Path(filepath.Join(f.config.ArtifactsDir, pidFileName)))
+	require.NoError(t, other.Lock())
+	other.Unlock()
+}
+
+func TestReconcileRetriesFailedRuntimeClasses(t *testing.T) {
+	f := newFixture(t, "kata-qemu", "kata-qemu-nvidia-gpu")
+	f.puller.errors = map[string]error{
+		"registry.example.com/kata/kata-qemu-nvidia-gpu:latest": fmt.Errorf("connection refused"),
+	}
+	m := f.manager(t)
+
+	_, err := m.Reconcile(context.Background(), "startup")
+	var rcErr *RuntimeClassError
+	require.ErrorAs(t, err, &rcErr)
+	require.Contains(t, rcErr.Errors, "kata-qemu-nvidia-gpu")
+
+	recorder := httptest.NewRecorder()
+	m.Status().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var status struct {
+		RuntimeClasses map[string]RuntimeClassStatus `json:"runtimeClasses"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	require.Equal(t, StateInstalled, status.RuntimeClasses["kata-qemu"].State)
+	require.Equal(t, StateFailed, status.RuntimeClasses["kata-qemu-nvidia-gpu"].State)
+	require.Contains(t, status.RuntimeClasses["kata-qemu-nvidia-gpu"].Reason, "connection refused")
+
+	f.puller.errors = nil
+	_, err = m.Reconcile(context.Background(), "periodic")
+	require.NoError(t, err)
+
+	recorder = httptest.NewRecorder()
+	m.Status().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, StateInstalled, m.RuntimeClasses()["kata-qemu-nvidia-gpu"].State)
+	require.Equal(t, map[string]string{
+		"kata.nvidia.com/kata-qemu":            "true",
+		"kata.nvidia.com/kata-qemu-nvidia-gpu": "true",
+	}, f.cluster.nodeLabels)
+	// Events are only recorded when the state of a runtime class changes
+	require.Equal(t, []string{"RuntimeClassFailed", "RuntimeClassInstalled", "RuntimeClassInstalled"}, f.cluster.events)
+}
+
+func TestReconcileRollbackRemovesLabels(t *testing.T) {
+	f := newFixture(t, "kata-qemu")
+	m := f.manager(t)
+
+	_, err := m.Reconcile(context.Background(), "startup")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"kata.nvidia.com/kata-qemu": "true"}, f.cluster.nodeLabels)
+
+	// The config is unchanged, so it is neither rolled back nor is the runtime restarted
+	f.verifier.err = fmt.Errorf("handler kata-qemu missing")
+	_, err = m.Reconcile(context.Background(), "periodic")
+	require.ErrorContains(t, err, "unable to verify runtime handlers")
+	require.Equal(t, 0, f.runtime.rollbacks)
+	require.Equal(t, 1, f.runtime.restarts)
+	require.Equal(t, StateFailed, m.RuntimeClasses()["kata-qemu"].State)
+	require.Empty(t, f.cluster.nodeLabels)
+}
+
+func TestWatchRuntimeConfigBacksOffFailedReconciles(t *testing.T) {
+	f := newFixture(t, "kata-qemu")
+	f.runtime.path = filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(f.runtime.path, nil, 0644))
+	f.verifier.err = fmt.Errorf("handler kata-qemu missing")
+	m := f.manager(t, WithWatchedPaths([]string{f.runtime.path}, nil))
+	restarts := func() int {
+		m.reconcileMu.Lock()
+		defer m.reconcileMu.Unlock()
+		return f.runtime.restarts
+	}
+
+	// The config written by the reconcile and its rollback is not a change
+	_, err := m.Reconcile(context.Background(), "startup")
+	require.ErrorContains(t, err, "unable to verify runtime handlers")
+	require.Equal(t, 2, f.runtime.restarts)
+	require.False(t, m.watchedChanged())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.watchRuntimeConfig(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(f.runtime.path, []byte("runc"), 0644))
+	require.Eventually(t, func() bool {
+		return restarts() == 4
+	}, 2*watchDebounce, 10*time.Millisecond)
+
+	// Another change while backing off is not reconciled before the backoff expires,
+	// and the rollback of the failed reconcile does not trigger a reconcile itself
+	require.NoError(t, os.WriteFile(f.runtime.path, []byte("crun"), 0644))
+	time.Sleep(2 * watchDebounce)
+	require.Equal(t, 4, restarts())
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/dryrun"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+)
+
+const (
+	// sysModuleDir is the sysfs directory holding an entry for every loaded kernel module
+	sysModuleDir = "/sys/module"
+	// kernelReleaseFile holds the release of the running kernel
+	kernelReleaseFile = "/proc/sys/kernel/osrelease"
+	// modulesLoadFile lists the persisted kernel modules loaded at boot
+	modulesLoadFile = "/etc/modules-load.d/nvidia-kata-manager.conf"
+	// modprobeOptionsFile holds the parameters of the persisted kernel modules
+	modprobeOptionsFile = "/etc/modprobe.d/nvidia-kata-manager.conf"
+
+	persistedFileHeader = "# Generated by k8s-kata-manager, do not edit\n"
+)
+
+// ModuleUnavailableError is returned when a kernel module is not available in the
+// host kernel
+type ModuleUnavailableError struct {
+	Module string
+	// Kernel is the release of the host kernel, if known
+	Kernel string
+}
+
+func (e *ModuleUnavailableError) Error() string {
+	if e.Kernel == "" {
+		return fmt.Sprintf("kernel module %s is not available in the host kernel", e.Module)
+	}
+	return fmt.Sprintf("kernel module %s is not available in the host kernel %s", e.Module, e.Kernel)
+}
+
+// loadKernelModules loads the kernel modules of the config on the host, verifies
+// that they are loaded and persists the modules to load at boot. Optional modules
+// not available in the host kernel are skipped.
+func (m *Manager) loadKernelModules(ctx context.Context) error {
+	if !m.loadModules {
+		return nil
+	}
+
+	var loaded []api.KernelModule
+	for _, module := range m.config.KernelModules {
+		err := m.loadKernelModule(ctx, module)
+		var unavailable *ModuleUnavailableError
+		if module.Optional && errors.As(err, &unavailable) {
+			klog.Infof("Skipping optional kernel module: %v", err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load module %s: %w", module.Name, err)
+		}
+		loaded = append(loaded, module)
+	}
+
+	modulesLoad, modprobeOptions := persistedModuleFiles(loaded)
+	if err := writeHostFile(m.root.Path(modulesLoadFile), modulesLoad); err != nil {
+		return fmt.Errorf("failed to persist kernel modules: %w", err)
+	}
+	if err := writeHostFile(m.root.Path(modprobeOptionsFile), modprobeOptions); err != nil {
+		return fmt.Errorf("failed to persist kernel module parameters: %w", err)
+	}
+	return nil
+}
+
+// loadKernelModule loads a kernel module with modprobe unless it is already loaded
+// and verifies that it is loaded afterwards
+func (m *Manager) loadKernelModule(ctx context.Context, module api.KernelModule) error {
+	if m.moduleLoaded(module.Name) {
+		klog.Infof("Kernel module %s is already loaded", module.Name)
+		m.checkModuleParameters(module)
+		return nil
+	}
+
+	klog.Infof("Loading kernel module %s", module.Name)
+	_, err := m.executor.Run(ctx, host.Modprobe, append([]string{module.Name}, module.Parameters...)...)
+	var cmdErr *host.CommandError
+	if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "not found") {
+		return &ModuleUnavailableError{Module: module.Name, Kernel: m.kernelRelease()}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Built-in modules without parameters have no entry in sysfs
+	if !m.moduleLoaded(module.Name) && !m.moduleBuiltin(module.Name) {
+		return fmt.Errorf("module not found in %s after loading it", sysModuleDir)
+	}
+	return nil
+}
+
+// moduleLoaded returns true if the kernel module has an entry in sysfs
+func (m *Manager) moduleLoaded(name string) bool {
+	_, err := os.Stat(m.root.Path(filepath.Join(sysModuleDir, sysfsModuleName(name))))
+	return err == nil
+}
+
+// moduleBuiltin returns true if the kernel module is built into the host kernel
+func (m *Manager) moduleBuiltin(name string) bool {
+	builtin, _ := m.moduleListed(name, "modules.builtin")
+	return builtin
+}
+
+// moduleAvailable returns true if the kernel module is loaded, built into the host
+// kernel or installed for it. Modules are assumed to be available if the module
+// index of the host kernel cannot be read.
+func (m *Manager) moduleAvailable(name string) bool {
+	if m.moduleLoaded(name) || m.moduleBuiltin(name) {
+		return true
+	}
+	installed, err := m.moduleListed(name, "modules.dep")
+	return installed || err != nil
+}
+
+// moduleListed returns true if the kernel module is listed in the module index file
+// of the host kernel, e.g. modules.builtin or modules.dep
+func (m *Manager) moduleListed(name string, index string) (bool, error) {
+	release := m.kernelRelease()
+	if release == "" {
+		return false, fmt.Errorf("unknown kernel release")
+	}
+	content, err := os.ReadFile(m.root.Path(filepath.Join("/lib/modules", release, index)))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		// modules.dep lines list the dependencies of the module after a colon, and
+		// module files may be compressed, e.g. kvm-amd.ko.zst
+		path, _, _ := strings.Cut(line, ":")
+		file, _, _ := strings.Cut(filepath.Base(path), ".ko")
+		if sysfsModuleName(file) == sysfsModuleName(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkModuleParameters warns about parameters of a loaded kernel module whose
+// values differ from the configured ones, as they only apply once it is reloaded
+func (m *Manager) checkModuleParameters(module api.KernelModule) {
+	for _, param := range module.Parameters {
+		key, value, _ := strings.Cut(param, "=")
+		path := filepath.Join(sysModuleDir, sysfsModuleName(module.Name), "parameters", key)
+		content, err := os.ReadFile(m.root.Path(path))
+		if err != nil {
+			continue
+		}
+		if current := strings.TrimSpace(string(content)); !sameParameterValue(current, value) {
+			klog.Warningf("Kernel module %s is loaded with %s=%s, %s=%s applies once it is reloaded", module.Name, key, current, key, value)
+		}
+	}
+}
+
+// kernelRelease returns the release of the host kernel, or an empty string if it
+// cannot be read
+func (m *Manager) kernelRelease() string {
+	content, err := os.ReadFile(m.root.Path(kernelReleaseFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// planKernelModules adds the kernel modules that would be loaded and the changes of
+// the files persisting them to the plan
+func (m *Manager) planKernelModules(plan *dryrun.Plan) error {
+	// Like when loading them, optional modules not available in the host kernel are
+	// skipped
+	var modules []api.KernelModule
+	for _, module := range m.config.KernelModules {
+		if module.Optional && !m.moduleAvailable(module.Name) {
+			klog.Infof("Skipping optional kernel module %s, it is not available in the host kernel", module.Name)
+			continue
+		}
+		modules = append(modules, module)
+		plan.KernelModules = append(plan.KernelModules, module.Name)
+	}
+
+	modulesLoad, modprobeOptions := persistedModuleFiles(modules)
+	files := []struct {
+		path    string
+		content []byte
+	}{
+		{modulesLoadFile, modulesLoad},
+		{modprobeOptionsFile, modprobeOptions},
+	}
+	for _, f := range files {
+		old, err := runtime.ReadFile(m.root.Path(f.path))
+		if err != nil {
+			return err
+		}
+		if _, err := plan.AddFile(f.path, old, f.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePersistedModules removes the files loading the persisted kernel modules at
+// boot
+func (m *Manager) removePersistedModules() error {
+	for _, path := range []string{modulesLoadFile, modprobeOptionsFile} {
+		if err := writeHostFile(m.root.Path(path), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persistedModuleFiles returns the content of the modules-load.d file loading the
+// persisted kernel modules at boot and of the modprobe.d file holding their
+// parameters. The content is nil if the file is not needed.
+func persistedModuleFiles(modules []api.KernelModule) ([]byte, []byte) {
+	var modulesLoad, modprobeOptions bytes.Buffer
+	for _, module := range modules {
+		if !module.Persist {
+			continue
+		}
+		fmt.Fprintln(&modulesLoad, module.Name)
+		if len(module.Parameters) > 0 {
+			fmt.Fprintf(&modprobeOptions, "options %s %s\n", module.Name, strings.Join(module.Parameters, " "))
+		}
+	}
+	return withHeader(modulesLoad.Bytes()), withHeader(modprobeOptions.Bytes())
+}
+
+func withHeader(content []byte) []byte {
+	if len(content) == 0 {
+		return nil
+	}
+	return append([]byte(persistedFileHeader), content...)
+}
+
+// writeHostFile writes the content to the file at path if it changed, or removes
+// the file if the content is nil
+func writeHostFile(path string, content []byte) error {
+	old, err := runtime.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case content == nil && old == nil:
+		return nil
+	case content == nil:
+		klog.Infof("Removing %s", path)
+		return os.Remove(path)
+	case bytes.Equal(old, content):
+		return nil
+	}
+
+	klog.Infof("Writing %s", path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// sysfsModuleName returns the name of the sysfs entry of a kernel module, in which
+// dashes are replaced with underscores
+func sysfsModuleName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// sameParameterValue compares module parameter values, treating the Y and N values
+// sysfs reports for boolean parameters like 1 and 0
+func sameParameterValue(current, value string) bool {
+	normalize := func(v string) string {
+		switch v {
+		case "Y", "y", "1":
+			return "1"
+		case "N", "n", "0":
+			return "0"
+		}
+		return v
+	}
+	return normalize(current) == normalize(value)
+}
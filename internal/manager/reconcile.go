@@ -0,0 +1,188 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/metrics"
+	"github.com/NVIDIA/k8s-kata-manager/internal/watch"
+)
+
+// reconcileResult is the result of a reconcile of the node
+type reconcileResult struct {
+	// Reason is what triggered the reconcile
+	Reason   string        `json:"reason"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// ModifiedFiles are the runtime config files whose settings had to be repaired
+	ModifiedFiles []string `json:"modifiedFiles,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// reconcileStatus holds the result of the last reconcile and the status of the
+// runtime classes
+type reconcileStatus struct {
+	sync.Mutex
+	last    *reconcileResult
+	classes map[string]RuntimeClassStatus
+}
+
+func (s *reconcileStatus) set(r reconcileResult) {
+	s.Lock()
+	defer s.Unlock()
+	s.last = &r
+}
+
+// ServeHTTP serves the result of the last reconcile and the status of the runtime
+// classes in JSON format. The status code is 503 until a reconcile has succeeded and
+// after a failed reconcile, including a reconcile in which some runtime classes
+// failed to install.
+func (s *reconcileStatus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if s.last == nil || s.last.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(struct {
+		LastReconcile  *reconcileResult              `json:"lastReconcile"`
+		RuntimeClasses map[string]RuntimeClassStatus `json:"runtimeClasses"`
+	}{s.last, s.classes})
+}
+
+// Status returns a handler serving the result of the last reconcile and the status
+// of the runtime classes
+func (m *Manager) Status() http.Handler {
+	return &m.status
+}
+
+// Run installs the runtime classes and keeps them installed until the context is
+// canceled. The runtime config is then removed according to the cleanup policy.
+func (m *Manager) Run(ctx context.Context) error {
+	if _, err := m.Reconcile(ctx, "startup"); err != nil {
+		var rcErr *RuntimeClassError
+		switch {
+		case ctx.Err() != nil:
+			klog.Infof("Signal received, exiting early: %v", err)
+			return nil
+		case errors.As(err, &rcErr):
+			klog.Warningf("Continuing with the runtime classes installed; failed runtime classes are retried on the next reconcile")
+		default:
+			return err
+		}
+	}
+
+	if len(m.watchedFiles) > 0 || len(m.watchedDirs) > 0 {
+		go m.watchRuntimeConfig(ctx)
+	}
+	klog.Infof("Reconciling until a termination signal is received")
+	m.reconcileLoop(ctx)
+
+	// Wait for a reconcile triggered by a change of the runtime config to be aborted
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+
+	// The context of the daemon is canceled by now, so the cleanup gets its own
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if !m.ShouldCleanUp(cleanupCtx) {
+		return nil
+	}
+	if err := m.CleanUp(cleanupCtx); err != nil {
+		return fmt.Errorf("unable to revert config: %w", err)
+	}
+	return nil
+}
+
+// RequestReconcile triggers a reconcile of the node while running. Requests made
+// while a reconcile is pending are coalesced.
+func (m *Manager) RequestReconcile(reason string) {
+	select {
+	case m.reconcileRequests <- reason:
+	default:
+	}
+}
+
+// Reconcile installs the runtime classes, repairing any drift from the desired state
+// of the node, and records the result. It returns the runtime config files whose
+// settings had to be modified. Reconciles are serialized.
+func (m *Manager) Reconcile(ctx context.Context, reason string) ([]string, error) {
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+
+	klog.Infof("Reconciling node (%s)", reason)
+	start := time.Now()
+	modified, err := m.Install(ctx)
+
+	result := reconcileResult{
+		Reason:        reason,
+		Start:         start,
+		Duration:      time.Since(start),
+		ModifiedFiles: modified,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		klog.Errorf("Reconcile failed after %v: %v", result.Duration, err)
+		metrics.Reconciles.Inc("failure")
+		metrics.LastReconcileSuccess.Set(0)
+	} else {
+		klog.Infof("Reconcile succeeded after %v", result.Duration)
+		metrics.Reconciles.Inc("success")
+		metrics.LastReconcileSuccess.Set(1)
+	}
+	metrics.LastReconcileTime.Set(float64(time.Now().Unix()))
+	m.status.set(result)
+	m.watchedContent = watch.Snapshot(m.watchedFiles, m.watchedDirs)
+	m.logRuntimeClasses()
+
+	return modified, err
+}
+
+// reconcileLoop reconciles the node periodically and whenever a reconcile is
+// requested, until the context is canceled
+func (m *Manager) reconcileLoop(ctx context.Context) {
+	var tick <-chan time.Time
+	if m.reconcileInterval > 0 {
+		ticker := time.NewTicker(m.reconcileInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			reason = "periodic"
+		case reason = <-m.reconcileRequests:
+		}
+
+		// Failures are retried on the next reconcile
+		_, _ = m.Reconcile(ctx, reason)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// RuntimeClassState is the state of a runtime class on the node
+type RuntimeClassState string
+
+const (
+	// StatePending is the state of a runtime class which has not been installed yet
+	StatePending RuntimeClassState = "pending"
+	// StatePulling is the state of a runtime class whose artifacts are being pulled
+	StatePulling RuntimeClassState = "pulling"
+	// StateInstalled is the state of a runtime class which is installed and
+	// registered with the runtime
+	StateInstalled RuntimeClassState = "installed"
+	// StateFailed is the state of a runtime class which failed to install
+	StateFailed RuntimeClassState = "failed"
+	// StateRemoved is the state of a runtime class which has been removed from the
+	// runtime config
+	StateRemoved RuntimeClassState = "removed"
+)
+
+// RuntimeClassStatus is the status of a runtime class on the node
+type RuntimeClassStatus struct {
+	State RuntimeClassState `json:"state"`
+	// Reason is why the runtime class failed to install
+	Reason string `json:"reason,omitempty"`
+	// Since is when the runtime class entered the state
+	Since time.Time `json:"since"`
+}
+
+// RuntimeClassError is returned when runtime classes failed to install. The other
+// runtime classes are installed nevertheless.
+type RuntimeClassError struct {
+	// Errors holds the error of each runtime class which failed to install
+	Errors map[string]error
+}
+
+func (e *RuntimeClassError) Error() string {
+	var names []string
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		errs = append(errs, fmt.Sprintf("runtime class %s: %v", name, e.Errors[name]))
+	}
+	return strings.Join(errs, "; ")
+}
+
+// RuntimeClasses returns the status of all runtime classes
+func (m *Manager) RuntimeClasses() map[string]RuntimeClassStatus {
+	m.status.Lock()
+	defer m.status.Unlock()
+
+	classes := make(map[string]RuntimeClassStatus, len(m.status.classes))
+	for name, status := range m.status.classes {
+		classes[name] = status
+	}
+	return classes
+}
+
+// runtimeClassState returns the state of a runtime class
+func (m *Manager) runtimeClassState(name string) RuntimeClassState {
+	m.status.Lock()
+	defer m.status.Unlock()
+	return m.status.classes[name].State
+}
+
+// setRuntimeClassState updates the status of a runtime class. Changes are logged and
+// recorded as events on the node.
+func (m *Manager) setRuntimeClassState(name string, state RuntimeClassState, reason string) {
+	m.status.Lock()
+	previous := m.status.classes[name]
+	changed := previous.State != state || previous.Reason != reason
+	if changed {
+		m.status.classes[name] = RuntimeClassStatus{State: state, Reason: reason, Since: time.Now()}
+	}
+	m.status.Unlock()
+
+	if !changed {
+		return
+	}
+
+	var eventType, eventReason, message string
+	switch state {
+	case StateInstalled:
+		klog.Infof("Runtime class %s installed", name)
+		eventType, eventReason, message = corev1.EventTypeNormal, "RuntimeClassInstalled", fmt.Sprintf("Runtime class %s installed", name)
+	case StateFailed:
+		klog.Errorf("Runtime class %s failed to install: %s", name, reason)
+		eventType, eventReason, message = corev1.EventTypeWarning, "RuntimeClassFailed", fmt.Sprintf("Runtime class %s failed to install: %s", name, reason)
+	case StateRemoved:
+		klog.Infof("Runtime class %s removed", name)
+		eventType, eventReason, message = corev1.EventTypeNormal, "RuntimeClassRemoved", fmt.Sprintf("Runtime class %s removed", name)
+	default:
+		klog.V(2).Infof("Runtime class %s is %s", name, state)
+		return
+	}
+
+	if m.cluster == nil {
+		return
+	}
+	m.cluster.RecordNodeEvent(eventType, eventReason, message)
+}
+
+// logRuntimeClasses logs the state of all runtime classes
+func (m *Manager) logRuntimeClasses() {
+	classes := m.RuntimeClasses()
+	var states []string
+	for _, rc := range m.config.RuntimeClasses {
+		status := classes[rc.Name]
+		state := fmt.Sprintf("%s=%s", rc.Name, status.State)
+		if status.Reason != "" {
+			state += fmt.Sprintf(" (%s)", status.Reason)
+		}
+		states = append(states, state)
+	}
+	klog.Infof("Runtime classes: %s", strings.Join(states, ", "))
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/watch"
+)
+
+const (
+	// watchDebounce is the quiet period after a change of the runtime config before
+	// the node is reconciled
+	watchDebounce = 2 * time.Second
+	// minRepairBackoff and maxRepairBackoff bound the delay between repairs of the
+	// runtime config when another tool keeps overwriting it
+	minRepairBackoff = 10 * time.Second
+	maxRepairBackoff = 10 * time.Minute
+)
+
+// WithWatchedPaths sets the runtime config files and drop-in directories which are
+// watched for changes made by other tools while running
+func WithWatchedPaths(files []string, dirs []string) Option {
+	return func(m *Manager) {
+		m.watchedFiles = files
+		m.watchedDirs = dirs
+	}
+}
+
+// watchRuntimeConfig reconciles the node whenever the runtime config is changed by
+// another tool, until the context is canceled. When another tool keeps removing or
+// altering the kata runtime settings, or the reconciles fail, reconciles are backed
+// off exponentially and an event naming the tool is recorded for every repair.
+func (m *Manager) watchRuntimeConfig(ctx context.Context) {
+	watcher, err := watch.New(watchDebounce, m.watchedFiles, m.watchedDirs)
+	if err != nil {
+		klog.Warningf("Not watching the runtime config for changes: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	changes := make(chan watch.Change, 16)
+	go watcher.Run(ctx, func(c watch.Change) {
+		select {
+		case changes <- c:
+		default:
+			// A reconcile is pending already
+		}
+	})
+	klog.Infof("Watching %s for changes", strings.Join(append(append([]string{}, m.watchedFiles...), m.watchedDirs...), ", "))
+
+	var backoff time.Duration
+	var lastRepair time.Time
+	for {
+		var change watch.Change
+		select {
+		case <-ctx.Done():
+			return
+		case change = <-changes:
+		}
+		change = drain(changes, change)
+		if !m.watchedChanged() {
+			klog.V(2).Infof("Ignoring change of %s written by kata manager", strings.Join(change.Paths, ", "))
+			continue
+		}
+
+		// Settings are also repaired when some runtime classes fail to install
+		modified, err := m.Reconcile(ctx, "runtime config changed: "+strings.Join(change.Paths, ", "))
+		if len(modified) == 0 && err == nil {
+			continue
+		}
+
+		// The kata runtime settings were removed or altered by another tool, or the
+		// reconcile failed and restored the previous config
+		if time.Since(lastRepair) > 2*backoff {
+			backoff = minRepairBackoff
+		} else {
+			backoff = min(2*backoff, maxRepairBackoff)
+		}
+		lastRepair = time.Now()
+
+		if len(modified) > 0 {
+			writers := "an unknown process"
+			if len(change.Writers) > 0 {
+				writers = strings.Join(change.Writers, ", ")
+			}
+			message := fmt.Sprintf("Kata runtime settings in %s were removed or altered by %s and have been re-applied; the next repair is delayed by %v",
+				strings.Join(modified, ", "), writers, backoff)
+			klog.Warning(message)
+			if m.cluster != nil {
+				m.cluster.RecordNodeEvent(corev1.EventTypeWarning, "RuntimeConfigOverwritten", message)
+			}
+		} else {
+			klog.Warningf("Reconcile after a change of the runtime config failed; the next reconcile is delayed by %v", backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// watchedChanged reports whether the watched files differ from their content after
+// the last reconcile. It waits for a running reconcile to finish.
+func (m *Manager) watchedChanged() bool {
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+	return !maps.Equal(watch.Snapshot(m.watchedFiles, m.watchedDirs), m.watchedContent)
+}
+
+// drain merges the pending changes into the change
+func drain(changes <-chan watch.Change, change watch.Change) watch.Change {
+	for {
+		select {
+		case c := <-changes:
+			change.Paths = append(change.Paths, c.Paths...)
+			change.Writers = append(change.Writers, c.Writers...)
+		default:
+			return change
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var (
+	// RuntimeConfigSaves counts the saves of the runtime config by result: written
+	// or unchanged
+	RuntimeConfigSaves = NewCounterVec("kata_manager_runtime_config_saves_total", "Saves of the runtime config by result.", "result")
+	// RuntimeRestarts counts the restarts of the runtime by result: restarted,
+	// skipped or failed
+	RuntimeRestarts = NewCounterVec("kata_manager_runtime_restarts_total", "Restarts of the container runtime by result.", "result")
+	// Reconciles counts the reconciles of the node by result: success or failure
+	Reconciles = NewCounterVec("kata_manager_reconciles_total", "Reconciles of the node by result.", "result")
+	// LastReconcileTime is the time the last reconcile finished
+	LastReconcileTime = NewGauge("kata_manager_last_reconcile_timestamp_seconds", "Time the last reconcile finished in seconds since the epoch.")
+	// LastReconcileSuccess is 1 if the last reconcile succeeded and 0 otherwise
+	LastReconcileSuccess = NewGauge("kata_manager_last_reconcile_success", "Whether the last reconcile succeeded.")
+)
+
+// collector writes metrics in the Prometheus text exposition format
+type collector interface {
+	write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// CounterVec is a set of counters partitioned by the value of a single label
+type CounterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// NewCounterVec creates a counter vector and registers it with the metrics handler
+func NewCounterVec(name string, help string, label string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		values: make(map[string]uint64),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the label value
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Value returns the counter for the label value
+func (c *CounterVec) Value(value string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[value]
+}
+
+// write writes the counters in the Prometheus text exposition format
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]string, 0, len(c.values))
+	for v := range c.values {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err := fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, v, c.values[v]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a single value which can go up and down
+type Gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a gauge and registers it with the metrics handler
+func NewGauge(name string, help string) *Gauge {
+	g := &Gauge{
+		name: name,
+		help: help,
+	}
+	register(g)
+	return g
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+// Value returns the value of the gauge
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.value)
+	return err
+}
+
+// Handler returns an HTTP handler serving all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		for _, c := range registry {
+			if err := c.write(w); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	c := NewCounterVec("test_total", "Test counter.", "result")
+	c.Inc("written")
+	c.Inc("unchanged")
+	c.Inc("written")
+	require.Equal(t, uint64(2), c.Value("written"))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	require.Contains(t, rec.Body.String(), `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{result="unchanged"} 1
+test_total{result="written"} 2
+`)
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_gauge", "Test gauge.")
+	g.Set(1.5)
+	require.Equal(t, 1.5, g.Value())
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	require.Contains(t, rec.Body.String(), "# TYPE test_gauge gauge\ntest_gauge 1.5\n")
+}
@@ -18,12 +18,16 @@ package oras
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
 	utils "github.com/NVIDIA/k8s-kata-manager/internal/utils"
 
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/klog/v2"
 	oras "oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content/file"
 	"oras.land/oras-go/v2/registry/remote"
@@ -52,7 +56,7 @@ func NewArtifact(ref string, output string) (*Artifact, error) {
 	if idx := strings.LastIndex(ref, "@"); idx != -1 {
 		repository = ref[:idx]
 		tag = ref[idx+1:]
-	} else if idx := strings.LastIndex(ref, ":"); idx != 1 {
+	} else if idx := strings.LastIndex(ref, ":"); idx != -1 {
 		repository = ref[:idx]
 		tag = ref[idx+1:]
 	} else {
@@ -67,6 +71,37 @@ func NewArtifact(ref string, output string) (*Artifact, error) {
 	}, nil
 }
 
+// dockerManifestMediaType is the media type of Docker image manifests, which share
+// the layout of OCI image manifests
+const dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// Manifest resolves the artifact reference and fetches its image manifest from the
+// remote repository without pulling any of the layers. References to image indexes
+// are rejected, as their layers would be missing from the decoded manifest.
+func (a *Artifact) Manifest(ctx context.Context, creds *auth.Credential) (ocispec.Descriptor, *ocispec.Manifest, error) {
+	repo, err := a.repository(creds)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	desc, content, err := oras.FetchBytes(ctx, repo, a.Tag, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("unable to fetch manifest: %w", err)
+	}
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, dockerManifestMediaType:
+	default:
+		return ocispec.Descriptor{}, nil, fmt.Errorf("unsupported manifest media type %q, expected an image manifest", desc.MediaType)
+	}
+
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("unable to decode manifest: %w", err)
+	}
+
+	return desc, manifest, nil
+}
+
 // Pull pulls the artifact from the remote repository into a local path
 func (a *Artifact) Pull(ctx context.Context, creds *auth.Credential) (ocispec.Descriptor, error) {
 	// Create a file store
@@ -77,11 +112,74 @@ func (a *Artifact) Pull(ctx context.Context, creds *auth.Credential) (ocispec.De
 	defer fs.Close()
 
 	// Connect to a remote repository
-	repo, err := remote.NewRepository(a.Repository)
+	repo, err := a.repository(creds)
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
+	// Copy from the remote repository to the file store
+	return oras.Copy(ctx, repo, a.Tag, fs, a.Tag, oras.DefaultCopyOptions)
+}
+
+// PullCached pulls the layers described by the manifest into the blob cache, skipping
+// blobs which are already cached, and links them into the output directory. Artifacts
+// containing directory layers are pulled without the cache.
+func (a *Artifact) PullCached(ctx context.Context, creds *auth.Credential, manifest *ocispec.Manifest, c *cache.Cache) error {
+	for _, layer := range manifest.Layers {
+		if layer.Annotations[file.AnnotationUnpack] == "true" {
+			_, err := a.Pull(ctx, creds)
+			return err
+		}
+	}
+
+	repo, err := a.repository(creds)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[ocispec.AnnotationTitle]
+		if name == "" {
+			continue
+		}
+		if !filepath.IsLocal(name) || filepath.Base(name) != name {
+			return fmt.Errorf("invalid layer title %q", name)
+		}
+
+		if c.Has(layer) {
+			klog.Infof("Using cached blob %s for %s", layer.Digest, name)
+		} else {
+			klog.Infof("Fetching blob %s for %s (%d bytes)", layer.Digest, name, layer.Size)
+			if err := fetchBlob(ctx, repo, layer, c); err != nil {
+				return err
+			}
+		}
+
+		if err := c.Link(layer.Digest, filepath.Join(a.Output, name)); err != nil {
+			return fmt.Errorf("unable to install %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func fetchBlob(ctx context.Context, repo *remote.Repository, desc ocispec.Descriptor, c *cache.Cache) error {
+	rc, err := repo.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("unable to fetch blob %s: %w", desc.Digest, err)
+	}
+	defer rc.Close()
+
+	return c.Ingest(desc, rc)
+}
+
+// repository returns a client for the remote repository hosting the artifact
+func (a *Artifact) repository(creds *auth.Credential) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(a.Repository)
+	if err != nil {
+		return nil, err
+	}
+
 	if creds != nil {
 		repo.Client = &auth.Client{
 			Client: retry.DefaultClient,
@@ -93,6 +191,5 @@ func (a *Artifact) Pull(ctx context.Context, creds *auth.Credential) (ocispec.De
 		}
 	}
 
-	// Copy from the remote repository to the file store
-	return oras.Copy(ctx, repo, a.Tag, fs, a.Tag, oras.DefaultCopyOptions)
+	return repo, nil
 }
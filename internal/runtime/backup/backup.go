@@ -0,0 +1,259 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+)
+
+// DirName is the name of the backup directory under the artifacts directory
+const DirName = ".backups"
+
+// Backup is a snapshot of a runtime config file taken before the file is first
+// modified. Snapshots are never overwritten, so restoring a backup always yields
+// the pristine file.
+type Backup struct {
+	// Path is the path of the backed up file on the host
+	Path string `json:"path"`
+	// Existed is false if the file did not exist when the snapshot was taken
+	Existed bool `json:"existed"`
+	// Checksum is the sha256 checksum of the original content of the file
+	Checksum string `json:"checksum,omitempty"`
+	// Created is the time at which the snapshot was taken
+	Created time.Time `json:"created"`
+
+	dir string
+}
+
+// Snapshot takes a snapshot of the file at path in the backup directory unless
+// one already exists, in which case the existing snapshot is returned. The snapshot
+// is recorded for the path of the file on the host mounted at root.
+func Snapshot(dir string, root host.Root, path string) (*Backup, error) {
+	b, err := Load(dir, root.HostPath(path))
+	if err != nil || b != nil {
+		return b, err
+	}
+
+	b = &Backup{
+		Path:    root.HostPath(path),
+		Created: time.Now().UTC(),
+		dir:     dir,
+	}
+
+	content, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("unable to read '%s': %w", path, err)
+	default:
+		b.Existed = true
+		b.Checksum = checksum(content)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory: %w", err)
+	}
+	if b.Existed {
+		if err := writeFile(b.contentPath(), content, 0600); err != nil {
+			return nil, fmt.Errorf("unable to back up '%s': %w", path, err)
+		}
+	}
+	metadata, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode backup metadata: %w", err)
+	}
+	if err := writeFile(b.metadataPath(), metadata, 0600); err != nil {
+		return nil, fmt.Errorf("unable to back up '%s': %w", path, err)
+	}
+
+	klog.Infof("Backed up original %v", path)
+	return b, nil
+}
+
+// Load returns the snapshot of the file at the path on the host, or nil if there is
+// none
+func Load(dir string, path string) (*Backup, error) {
+	return load(filepath.Join(dir, Name(path)+".json"))
+}
+
+// List returns all snapshots in the backup directory
+func List(dir string) ([]*Backup, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var backups []*Backup
+	for _, f := range files {
+		b, err := load(f)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			backups = append(backups, b)
+		}
+	}
+	return backups, nil
+}
+
+// RestoreFiles restores the files at paths from their snapshots in the backup
+// directory, for the host mounted at root. Files without a snapshot are left
+// untouched.
+func RestoreFiles(dir string, root host.Root, paths ...string) error {
+	var errs []error
+	for _, path := range paths {
+		b, err := Load(dir, root.HostPath(path))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if b == nil {
+			klog.Infof("No backup of %v to restore", path)
+			continue
+		}
+		if err := b.Restore(root); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DiscardAll removes all snapshots in the backup directory
+func DiscardAll(dir string) error {
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		if err := b.Discard(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore restores the file to its original content, or removes it if it did not
+// exist originally, and discards the snapshot. The content of the snapshot is
+// verified against its checksum before being restored. The file is restored on the
+// host mounted at root.
+func (b *Backup) Restore(root host.Root) error {
+	if !b.Existed {
+		if err := os.Remove(root.Path(b.Path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove '%s': %w", b.Path, err)
+		}
+		klog.Infof("Restored %v by removing it", b.Path)
+		return b.Discard()
+	}
+
+	content, err := os.ReadFile(b.contentPath())
+	if err != nil {
+		return fmt.Errorf("unable to read backup of '%s': %w", b.Path, err)
+	}
+	if sum := checksum(content); sum != b.Checksum {
+		return fmt.Errorf("backup of '%s' is corrupted: checksum %s does not match %s", b.Path, sum, b.Checksum)
+	}
+	if err := writeFile(root.Path(b.Path), content, 0644); err != nil {
+		return fmt.Errorf("unable to restore '%s': %w", b.Path, err)
+	}
+
+	klog.Infof("Restored original %v", b.Path)
+	return b.Discard()
+}
+
+// Discard removes the snapshot
+func (b *Backup) Discard() error {
+	for _, f := range []string{b.contentPath(), b.metadataPath()} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the content is identical to the original content of the file
+func (b *Backup) Matches(content []byte) bool {
+	if content == nil {
+		return !b.Existed
+	}
+	return b.Existed && checksum(content) == b.Checksum
+}
+
+func (b *Backup) contentPath() string {
+	return filepath.Join(b.dir, Name(b.Path)+".orig")
+}
+
+func (b *Backup) metadataPath() string {
+	return filepath.Join(b.dir, Name(b.Path)+".json")
+}
+
+func load(metadataPath string) (*Backup, error) {
+	metadata, err := os.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backup metadata: %w", err)
+	}
+
+	b := &Backup{dir: filepath.Dir(metadataPath)}
+	if err := json.Unmarshal(metadata, b); err != nil {
+		return nil, fmt.Errorf("unable to decode backup metadata '%s': %w", metadataPath, err)
+	}
+	return b, nil
+}
+
+// Name returns the name under which the backup and other state of a file are stored
+func Name(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(filepath.Clean(path), "/"), "/", "_")
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFile atomically replaces the file at path
+func writeFile(path string, content []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
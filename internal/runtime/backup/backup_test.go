@@ -0,0 +1,156 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, DirName)
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	b, err := Snapshot(backupDir, "", path)
+	require.NoError(t, err)
+	require.True(t, b.Existed)
+	require.True(t, b.Matches([]byte("original")))
+
+	// A second snapshot keeps the pristine content
+	require.NoError(t, os.WriteFile(path, []byte("modified"), 0644))
+	b, err = Snapshot(backupDir, "", path)
+	require.NoError(t, err)
+	require.True(t, b.Matches([]byte("original")))
+
+	require.NoError(t, b.Restore(""))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "original", string(content))
+
+	b, err = Load(backupDir, path)
+	require.NoError(t, err)
+	require.Nil(t, b)
+}
+
+func TestSnapshotMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, DirName)
+	path := filepath.Join(dir, "conf.d", "99-kata.toml")
+
+	b, err := Snapshot(backupDir, "", path)
+	require.NoError(t, err)
+	require.False(t, b.Existed)
+	require.True(t, b.Matches(nil))
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("added"), 0644))
+
+	require.NoError(t, RestoreFiles(backupDir, "", path, filepath.Join(dir, "unknown.toml")))
+	require.NoFileExists(t, path)
+
+	backups, err := List(backupDir)
+	require.NoError(t, err)
+	require.Empty(t, backups)
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, DirName)
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	b, err := Snapshot(backupDir, "", path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(b.contentPath(), []byte("tampered"), 0600))
+	require.NoError(t, os.WriteFile(path, []byte("modified"), 0644))
+
+	require.ErrorContains(t, b.Restore(""), "corrupted")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "modified", string(content))
+}
+
+func TestDiscardAll(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, DirName)
+	for _, name := range []string{"a.toml", "b.toml"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		_, err := Snapshot(backupDir, "", path)
+		require.NoError(t, err)
+	}
+
+	backups, err := List(backupDir)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	require.NoError(t, DiscardAll(backupDir))
+	backups, err = List(backupDir)
+	require.NoError(t, err)
+	require.Empty(t, backups)
+}
+
+func TestSnapshotHostRoot(t *testing.T) {
+	root := host.Root(t.TempDir())
+	backupDir := root.Path("/opt/artifacts/" + DirName)
+	path := root.Path("/etc/containerd/config.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	b, err := Snapshot(backupDir, root, path)
+	require.NoError(t, err)
+	// The snapshot is recorded for the path on the host
+	require.Equal(t, "/etc/containerd/config.toml", b.Path)
+	require.FileExists(t, filepath.Join(backupDir, "etc_containerd_config.toml.json"))
+
+	require.NoError(t, os.WriteFile(path, []byte("modified"), 0644))
+	require.NoError(t, RestoreFiles(backupDir, root, path))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "original", string(content))
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "config.toml")
+	missing := filepath.Join(dir, "conf.d", "99-kata.toml")
+	require.NoError(t, os.WriteFile(existing, []byte("previous"), 0600))
+
+	c, err := NewCheckpoint(existing, "", missing)
+	require.NoError(t, err)
+	require.Equal(t, []string{existing, missing}, c.Paths())
+
+	require.NoError(t, os.WriteFile(existing, []byte("updated"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(missing), 0755))
+	require.NoError(t, os.WriteFile(missing, []byte("updated"), 0644))
+
+	require.NoError(t, c.Restore())
+	content, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(content))
+	info, err := os.Stat(existing)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	require.NoFileExists(t, missing)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+)
+
+// Checkpoint holds the content of files right before they are overwritten, so that
+// a failed update can be reverted to the previous state of the files without losing
+// the changes made to them since their original content was backed up. Checkpoints
+// are only kept in memory.
+type Checkpoint struct {
+	files []checkpointFile
+}
+
+type checkpointFile struct {
+	path string
+	// content is nil if the file did not exist
+	content []byte
+	perm    os.FileMode
+}
+
+// NewCheckpoint records the current content of the files at paths. Empty paths are
+// ignored.
+func NewCheckpoint(paths ...string) (*Checkpoint, error) {
+	c := &Checkpoint{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		f := checkpointFile{path: path}
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, fmt.Errorf("unable to checkpoint '%s': %w", path, err)
+		default:
+			f.perm = info.Mode().Perm()
+			if f.content, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("unable to checkpoint '%s': %w", path, err)
+			}
+		}
+		c.files = append(c.files, f)
+	}
+	return c, nil
+}
+
+// Paths returns the paths of the files in the checkpoint
+func (c *Checkpoint) Paths() []string {
+	var paths []string
+	for _, f := range c.files {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// Restore restores the files to the content recorded in the checkpoint, removing
+// the files which did not exist
+func (c *Checkpoint) Restore() error {
+	var errs []error
+	for _, f := range c.files {
+		if f.content == nil {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("unable to remove '%s': %w", f.path, err))
+			}
+			continue
+		}
+		if err := writeFile(f.path, f.content, f.perm); err != nil {
+			errs = append(errs, fmt.Errorf("unable to restore '%s': %w", f.path, err))
+			continue
+		}
+		klog.Infof("Restored previous %v", f.path)
+	}
+	return errors.Join(errs...)
+}
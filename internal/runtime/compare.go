@@ -0,0 +1,38 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Equivalent reports whether two TOML documents hold the same settings, ignoring
+// formatting, comments and the order of keys
+func Equivalent(a []byte, b []byte) (bool, error) {
+	treeA, err := toml.LoadBytes(a)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse config: %w", err)
+	}
+	treeB, err := toml.LoadBytes(b)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse config: %w", err)
+	}
+	return reflect.DeepEqual(treeA.ToMap(), treeB.ToMap()), nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEquivalent(t *testing.T) {
+	testCases := []struct {
+		description string
+		a           string
+		b           string
+		expected    bool
+	}{
+		{
+			description: "formatting and comments differ",
+			a: `# managed by kata manager
+[crio.runtime.runtimes.kata]
+  runtime_path = "/opt/kata/bin/containerd-shim-kata-v2"
+  privileged_without_host_devices = true
+`,
+			b:        "[crio.runtime.runtimes.kata]\nprivileged_without_host_devices = true\nruntime_path = \"/opt/kata/bin/containerd-shim-kata-v2\"\n",
+			expected: true,
+		},
+		{
+			description: "value differs",
+			a:           "[crio.runtime.runtimes.kata]\nruntime_path = \"/opt/kata/bin/kata\"\n",
+			b:           "[crio.runtime.runtimes.kata]\nruntime_path = \"/usr/bin/kata\"\n",
+		},
+		{
+			description: "key missing",
+			a:           "version = 2\n",
+			b:           "version = 2\nimports = [\"/etc/containerd/conf.d/*.toml\"]\n",
+		},
+		{
+			description: "both empty",
+			expected:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			equal, err := Equivalent([]byte(tc.a), []byte(tc.b))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, equal)
+		})
+	}
+}
+
+func TestFileChangeModified(t *testing.T) {
+	config := []byte("version = 2\n")
+	require.False(t, FileChange{Old: config, New: []byte("# comment\nversion = 2\n")}.Modified())
+	require.True(t, FileChange{Old: config, New: []byte("version = 3\n")}.Modified())
+	require.True(t, FileChange{New: config}.Modified())
+	require.False(t, FileChange{}.Modified())
+}
@@ -17,34 +17,66 @@
 package containerd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"path/filepath"
 
 	"github.com/pelletier/go-toml"
 	"k8s.io/klog/v2"
 
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/metrics"
 	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 )
 
 // Config represents the containerd config
 type Config struct {
 	*toml.Tree
+	// Version is the containerd config version; it determines the plugin under which
+	// runtimes are configured. Zero is treated as version 2.
+	Version               int64
 	RuntimeType           string
 	UseDefaultRuntimeName bool
 	PodAnnotations        []string
 	Path                  string
 	Socket                string
+	// ImportedBy is the path of the main config importing the config at Path when
+	// running in drop-in mode; it is empty otherwise.
+	ImportedBy string
+	// BackupDir is the directory in which the original config files are backed up
+	// before they are first modified; no backups are taken if it is empty.
+	BackupDir string
+	// Restarter restarts containerd; containerd is sent a SIGHUP if it is nil
+	Restarter restart.Strategy
+	// HostRoot is the path the host root filesystem is mounted at
+	HostRoot host.Root
+
+	// owned tracks the keys created or changed by kata manager, so that removing a
+	// runtime restores pre-existing settings
+	owned *ownership.Records
+	// checkpoint holds the content of the config files and ownership records before
+	// the last Save
+	checkpoint *backup.Checkpoint
+	// unchanged is set when the last Save found the config files to already hold
+	// the rendered config, in which case containerd is not restarted
+	unchanged bool
 }
 
 func Setup(o *runtime.Options) (runtime.Runtime, error) {
 	ctrdConfig, err := New(
 		WithPath(o.Path),
+		WithDropInPath(o.DropInPath),
 		WithPodAnnotations(o.PodAnnotations...),
 		WithRuntimeType(o.RuntimeType),
 		WithSocket(o.Socket),
+		WithBackupDir(o.BackupDir),
+		WithRestarter(o.Restarter),
+		WithHostRoot(o.HostRoot),
 	)
 	return ctrdConfig, err
 }
@@ -60,32 +92,80 @@ func New(opts ...Option) (*Config, error) {
 }
 
 // AddRuntime adds a runtime to the containerd config
-func (c *Config) AddRuntime(name string, path string, setAsDefault bool) error {
+func (c *Config) AddRuntime(name string, path string, opts runtime.RuntimeClassOptions) error {
 	if c == nil || c.Tree == nil {
 		return fmt.Errorf("config is nil")
 	}
 	config := *c.Tree
 
-	cfgPath := config.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name})
+	runtimePath := c.containerdPath("runtimes", name)
+	key := func(keys ...string) []string {
+		return append(append([]string{}, runtimePath...), keys...)
+	}
+
+	if err := c.owned.Track(&config, runtimePath...); err != nil {
+		return err
+	}
+
+	cfgPath := config.GetPath(runtimePath)
 	if kata, ok := cfgPath.(*toml.Tree); ok {
 		kata, err := toml.Load(kata.String())
 		if err != nil {
 			return fmt.Errorf("failed to load kata config: %w", err)
 		}
-		config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name}, kata)
+		config.SetPath(runtimePath, kata)
 	}
 
-	if config.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name}) == nil {
-		config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name, "runtime_type"}, c.RuntimeType)
-		config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name, "privileged_without_host_devices"}, true)
+	if config.GetPath(runtimePath) == nil {
+		config.SetPath(key("runtime_type"), c.RuntimeType)
+		config.SetPath(key("privileged_without_host_devices"), true)
+	}
+	if opts.RuntimeType != "" {
+		config.SetPath(key("runtime_type"), opts.RuntimeType)
+	}
+	if opts.PrivilegedWithoutHostDevices != nil {
+		config.SetPath(key("privileged_without_host_devices"), *opts.PrivilegedWithoutHostDevices)
+	}
+	if opts.RuntimePath != "" {
+		config.SetPath(key("runtime_path"), opts.RuntimePath)
+	}
+	if opts.Snapshotter != "" {
+		config.SetPath(key("snapshotter"), opts.Snapshotter)
+	}
+	if opts.SandboxMode != "" {
+		config.SetPath(key("sandbox_mode"), opts.SandboxMode)
+	}
+	if opts.CgroupWritable != nil {
+		config.SetPath(key("cgroup_writable"), *opts.CgroupWritable)
 	}
 
-	config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name, "pod_annotations"}, c.PodAnnotations)
+	podAnnotations := c.PodAnnotations
+	if opts.PodAnnotations != nil {
+		podAnnotations = opts.PodAnnotations
+	}
+	config.SetPath(key("pod_annotations"), podAnnotations)
+	if len(opts.ContainerAnnotations) > 0 {
+		config.SetPath(key("container_annotations"), opts.ContainerAnnotations)
+	}
 
-	config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name, "options", "ConfigPath"}, path)
+	config.SetPath(key("options", "ConfigPath"), path)
+	if opts.SystemdCgroup != nil {
+		config.SetPath(key("options", "SystemdCgroup"), *opts.SystemdCgroup)
+	}
 
-	if setAsDefault {
-		config.SetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "default_runtime_name"}, name)
+	if opts.SetAsDefault {
+		if err := c.owned.Track(&config, c.defaultRuntimePath()...); err != nil {
+			return err
+		}
+		if c.useLegacyDefaultRuntime() {
+			defaultRuntime, err := toml.Load(config.GetPath(runtimePath).(*toml.Tree).String())
+			if err != nil {
+				return fmt.Errorf("failed to load kata config: %w", err)
+			}
+			config.SetPath(c.containerdPath("default_runtime"), defaultRuntime)
+		} else {
+			config.SetPath(c.containerdPath("default_runtime_name"), name)
+		}
 	}
 
 	*c.Tree = config
@@ -94,13 +174,15 @@ func (c *Config) AddRuntime(name string, path string, setAsDefault bool) error {
 
 // DefaultRuntime returns the default runtime for the containerd config
 func (c *Config) DefaultRuntime() string {
-	if runtime, ok := c.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "default_runtime_name"}).(string); ok {
+	if runtime, ok := c.GetPath(c.containerdPath("default_runtime_name")).(string); ok {
 		return runtime
 	}
 	return ""
 }
 
-// RemoveRuntime removes a runtime from the containerd config
+// RemoveRuntime removes a runtime from the containerd config. If kata manager
+// tracks the runtime, the settings it had before they were first changed by kata
+// manager are restored instead.
 func (c *Config) RemoveRuntime(name string) error {
 	if c == nil || c.Tree == nil {
 		return nil
@@ -108,18 +190,44 @@ func (c *Config) RemoveRuntime(name string) error {
 
 	config := *c.Tree
 
-	if err := config.DeletePath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name}); err != nil {
+	runtimePath := c.containerdPath("runtimes", name)
+	restored, err := c.owned.Restore(&config, runtimePath...)
+	if err != nil {
 		return err
 	}
-	if runtime, ok := config.GetPath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "default_runtime_name"}).(string); ok {
+	if restored {
+		if _, err := c.owned.Restore(&config, c.defaultRuntimePath()...); err != nil {
+			return err
+		}
+		return c.prune(&config, runtimePath)
+	}
+
+	if runtime, ok := config.GetPath(runtimePath).(*toml.Tree); ok && c.useLegacyDefaultRuntime() {
+		if defaultRuntime, ok := config.GetPath(c.containerdPath("default_runtime")).(*toml.Tree); ok && defaultRuntime.String() == runtime.String() {
+			if err := config.DeletePath(c.containerdPath("default_runtime")); err != nil {
+				return err
+			}
+		}
+	}
+	if config.HasPath(runtimePath) {
+		if err := config.DeletePath(runtimePath); err != nil {
+			return err
+		}
+	}
+	if runtime, ok := config.GetPath(c.containerdPath("default_runtime_name")).(string); ok {
 		if runtime == name {
-			if err := config.DeletePath([]string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "default_runtime_name"}); err != nil {
+			if err := config.DeletePath(c.containerdPath("default_runtime_name")); err != nil {
 				return err
 			}
 		}
 	}
 
-	runtimePath := []string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", name}
+	return c.prune(&config, runtimePath)
+}
+
+// prune removes the tables along the runtime path which have been left empty, and
+// the version of a config without any other settings
+func (c *Config) prune(config *toml.Tree, runtimePath []string) error {
 	for i := 0; i < len(runtimePath); i++ {
 		if runtimes, ok := config.GetPath(runtimePath[:len(runtimePath)-i]).(*toml.Tree); ok {
 			if len(runtimes.Keys()) == 0 {
@@ -136,11 +244,46 @@ func (c *Config) RemoveRuntime(name string) error {
 		}
 	}
 
-	*c.Tree = config
+	*c.Tree = *config
 	return nil
 }
 
-// Save writes the config to the specified path
+// defaultRuntimePath returns the path of the key setting the default runtime
+func (c *Config) defaultRuntimePath() []string {
+	if c.useLegacyDefaultRuntime() {
+		return c.containerdPath("default_runtime")
+	}
+	return c.containerdPath("default_runtime_name")
+}
+
+// containerdPath returns the path of the specified keys relative to the containerd
+// section of the CRI plugin for the config version:
+//
+//	version 1: plugins.cri.containerd
+//	version 2: plugins."io.containerd.grpc.v1.cri".containerd
+//	version 3: plugins."io.containerd.cri.v1.runtime".containerd
+func (c *Config) containerdPath(keys ...string) []string {
+	var path []string
+	switch c.Version {
+	case 1:
+		path = []string{"plugins", "cri", "containerd"}
+	case 3:
+		path = []string{"plugins", "io.containerd.cri.v1.runtime", "containerd"}
+	default:
+		path = []string{"plugins", "io.containerd.grpc.v1.cri", "containerd"}
+	}
+	return append(path, keys...)
+}
+
+// useLegacyDefaultRuntime returns true if the default runtime is set through the
+// legacy default_runtime table instead of default_runtime_name. This is only
+// supported for version 1 configs.
+func (c *Config) useLegacyDefaultRuntime() bool {
+	return c.Version == 1 && !c.UseDefaultRuntimeName
+}
+
+// Save writes the config to the specified path. Nothing is written if the config
+// files already hold equivalent settings.
 func (c *Config) Save() (int64, error) {
 	config := c.Tree
 	output, err := config.ToTomlString()
@@ -153,12 +296,119 @@ func (c *Config) Save() (int64, error) {
 		return int64(len(output)), nil
 	}
 
+	// The files about to be overwritten are checkpointed, so that a failed update is
+	// reverted to the config the runtime ran with before
+	c.checkpoint, err = backup.NewCheckpoint(c.Path, c.ImportedBy, c.owned.Path())
+	if err != nil {
+		return 0, err
+	}
+
+	// The records are persisted first, so that keys changed by an interrupted save
+	// are never mistaken for pre-existing settings
+	if err := c.owned.Save(); err != nil {
+		return 0, err
+	}
+
+	c.unchanged, err = c.isUnchanged(output)
+	if err != nil {
+		return 0, err
+	}
+	if c.unchanged {
+		klog.Infof("Config %v is unchanged, not saving", c.Path)
+		metrics.RuntimeConfigSaves.Inc("unchanged")
+		return int64(len(output)), nil
+	}
+
+	n, err := c.write(output)
+	if err != nil {
+		return 0, err
+	}
+	metrics.RuntimeConfigSaves.Inc("written")
+	return n, nil
+}
+
+// isUnchanged reports whether the config files already hold the rendered config.
+// In drop-in mode, the main config also has to import the drop-in file, or must not
+// import it if the drop-in file is removed.
+func (c *Config) isUnchanged(output string) (bool, error) {
+	old, err := runtime.ReadFile(c.Path)
+	if err != nil {
+		return false, err
+	}
+	if old == nil {
+		if len(output) > 0 {
+			return false, nil
+		}
+		return c.isUnimported()
+	}
+	if len(output) == 0 {
+		return false, nil
+	}
+	equal, err := runtime.Equivalent(old, []byte(output))
+	if err != nil {
+		klog.Warningf("Unable to compare config %v, overwriting it: %v", c.Path, err)
+		return false, nil
+	}
+	if !equal || c.ImportedBy == "" {
+		return equal, nil
+	}
+
+	content, err := runtime.ReadFile(c.ImportedBy)
+	if err != nil {
+		return false, err
+	}
+	imported, err := importConfig(content, c.importPath(), c.Version)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(content, imported), nil
+}
+
+// isUnimported reports whether the main config does not import the drop-in file
+func (c *Config) isUnimported() (bool, error) {
+	if c.ImportedBy == "" {
+		return true, nil
+	}
+	content, err := runtime.ReadFile(c.ImportedBy)
+	if err != nil || content == nil {
+		return content == nil, err
+	}
+	unimported, err := unimportConfig(content, c.importPath())
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(content, unimported), nil
+}
+
+// write writes the rendered config to the config files, or removes the config file
+// if the rendered config is empty
+func (c *Config) write(output string) (int64, error) {
+	b, err := c.snapshot(c.Path)
+	if err != nil {
+		return 0, err
+	}
+
 	if len(output) == 0 {
 		err := os.Remove(c.Path)
-		if err != nil {
+		if err != nil && !os.IsNotExist(err) {
 			return 0, fmt.Errorf("unable to remove empty file: %w", err)
 		}
-		return 0, nil
+		if err := discardIfPristine(b, nil); err != nil {
+			return 0, err
+		}
+		return 0, c.unimport()
+	}
+
+	if c.ImportedBy != "" {
+		if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+			return 0, fmt.Errorf("unable to create drop-in directory: %w", err)
+		}
+		if _, err := c.snapshot(c.ImportedBy); err != nil {
+			return 0, err
+		}
+		if err := ensureImported(c.ImportedBy, c.importPath(), c.Version); err != nil {
+			return 0, fmt.Errorf("unable to import drop-in config: %w", err)
+		}
 	}
 
 	f, err := os.Create(c.Path)
@@ -172,47 +422,157 @@ func (c *Config) Save() (int64, error) {
 		return 0, fmt.Errorf("unable to write output: %w", err)
 	}
 
-	return int64(n), err
+	return int64(n), discardIfPristine(b, []byte(output))
 }
 
-func (c *Config) Restart() error {
+// unimport removes the import of the removed drop-in file from the main config, and
+// discards the backup of the main config once it is back to its original content
+func (c *Config) unimport() error {
+	if c.ImportedBy == "" {
+		return nil
+	}
+	if err := ensureNotImported(c.ImportedBy, c.importPath()); err != nil {
+		return fmt.Errorf("unable to remove import of drop-in config: %w", err)
+	}
+	if c.BackupDir == "" {
+		return nil
+	}
+	b, err := backup.Load(c.BackupDir, c.HostRoot.HostPath(c.ImportedBy))
+	if err != nil {
+		return err
+	}
+	content, err := runtime.ReadFile(c.ImportedBy)
+	if err != nil {
+		return err
+	}
+	return discardIfPristine(b, content)
+}
 
-	// Create a channel to receive signals
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+// Changes returns the changes Save would make to the config files
+func (c *Config) Changes() ([]runtime.FileChange, error) {
+	output, err := c.ToTomlString()
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert to TOML: %w", err)
+	}
 
-	// Set up a timer to ignore the signal for 5 seconds
-	ignoreTimer := time.NewTimer(5 * time.Second)
+	var changes []runtime.FileChange
+	if c.ImportedBy != "" {
+		old, err := runtime.ReadFile(c.ImportedBy)
+		if err != nil {
+			return nil, err
+		}
+		updated := old
+		switch {
+		case len(output) > 0:
+			updated, err = importConfig(old, c.importPath(), c.Version)
+		case old != nil:
+			updated, err = unimportConfig(old, c.importPath())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to update '%s': %w", c.ImportedBy, err)
+		}
+		changes = append(changes, runtime.FileChange{Path: c.ImportedBy, Old: old, New: updated})
+	}
 
-	// Create a channel to signal when the function has finished executing
-	done := make(chan error)
+	old, err := runtime.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	change := runtime.FileChange{Path: c.Path, Old: old}
+	if len(output) > 0 {
+		change.New = []byte(output)
+	}
+	return append(changes, change), nil
+}
+
+// restarter returns the restart strategy of the config
+func (c *Config) restarter() restart.Strategy {
+	if c.Restarter != nil {
+		return c.Restarter
+	}
+	s, _ := restart.New(restart.Options{Strategy: restart.Signal, Socket: c.Socket})
+	return s
+}
+
+// RestartContainerd restarts containerd by sending a SIGHUP signal to the containerd daemon
+func RestartContainerd(ctx context.Context, socket string) error {
+	return restart.SignalRestart(ctx, socket)
+}
+
+// Unchanged returns true if the last Save found the config to be up to date already
+func (c *Config) Unchanged() bool {
+	return c.unchanged
+}
+
+// Rollback restores the config files and ownership records to the content they had
+// before the last Save. The backups of the original files are kept for cleanup, and
+// discarded if the files are back to their original content.
+func (c *Config) Rollback() error {
+	if c.checkpoint == nil {
+		return fmt.Errorf("no saved config to roll back")
+	}
+	// The restored config always has to be picked up by containerd
+	c.unchanged = false
+	if err := c.checkpoint.Restore(); err != nil {
+		return err
+	}
 
-	// Start the function in a goroutine
-	go func() {
-		// Execute your function here
-		err := RestartContainerd(c.Socket)
+	owned, err := ownership.Load(c.BackupDir, c.HostRoot.HostPath(c.Path))
+	if err != nil {
+		return err
+	}
+	c.owned = owned
+
+	if c.BackupDir == "" {
+		return nil
+	}
+	for _, path := range c.checkpoint.Paths() {
+		b, err := backup.Load(c.BackupDir, c.HostRoot.HostPath(path))
 		if err != nil {
-			klog.Errorf("error restarting containerd: %v", err)
-			done <- err
-		}
-		// Since we are restarting containerd we need to
-		// Ignore the SIGTERM signal for 5 seconds
-		<-ignoreTimer.C
-		// Signal that the function has finished executing
-		done <- nil
-	}()
-
-	// Wait for the function to finish executing or for the signal to be received
-	select {
-	case err := <-done:
+			return err
+		}
+		content, err := runtime.ReadFile(path)
 		if err != nil {
 			return err
 		}
-	case s := <-sigs:
-		fmt.Printf("Received signal %v", s)
-		// Reset the timer to ignore the signal for another 5 seconds
-		ignoreTimer.Reset(5 * time.Second)
+		if err := discardIfPristine(b, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot backs up the file at path unless it has been backed up before
+func (c *Config) snapshot(path string) (*backup.Backup, error) {
+	if c.BackupDir == "" {
+		return nil, nil
+	}
+	b, err := backup.Snapshot(c.BackupDir, c.HostRoot, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to back up config: %w", err)
 	}
+	return b, nil
+}
 
+// discardIfPristine discards the backup once the file is back to its original content
+func discardIfPristine(b *backup.Backup, content []byte) error {
+	if b == nil || !b.Matches(content) {
+		return nil
+	}
+	return b.Discard()
+}
+
+// Restart restarts containerd using the restart strategy of the config
+func (c *Config) Restart(ctx context.Context) error {
+	if c.unchanged {
+		klog.Infof("Config is unchanged, not restarting containerd")
+		metrics.RuntimeRestarts.Inc("skipped")
+		return nil
+	}
+	if err := c.restarter().Restart(ctx); err != nil {
+		metrics.RuntimeRestarts.Inc("failed")
+		return fmt.Errorf("error restarting containerd: %w", err)
+	}
+	metrics.RuntimeRestarts.Inc("restarted")
 	return nil
 }
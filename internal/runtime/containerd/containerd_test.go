@@ -17,25 +17,39 @@
 package containerd
 
 import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/pelletier/go-toml"
 	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri/fake"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 )
 
 func TestConfig_AddRuntime(t *testing.T) {
 	const (
-		runtime        = "kata"
+		runtimeName    = "kata"
 		runtimeType    = "io.containerd.kata.v2"
 		kataConfigPath = "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu-snp/configuration-kata-qemu-nvidia-gpu-snp.toml"
 	)
 
 	testcases := []struct {
+		description    string
 		runtimeName    string
+		options        runtime.RuntimeClassOptions
 		expectedConfig map[string]interface{}
 	}{
 		{
-			runtimeName: runtime,
+			description: "default runtime type",
+			runtimeName: runtimeName,
 			expectedConfig: map[string]interface{}{
 				"plugins": map[string]interface{}{
 					"io.containerd.grpc.v1.cri": map[string]interface{}{
@@ -55,32 +69,340 @@ func TestConfig_AddRuntime(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "runtime type overridden for runtime class",
+			runtimeName: runtimeName,
+			options: runtime.RuntimeClassOptions{
+				RuntimeType:  "io.containerd.kata-qemu-snp.v2",
+				SetAsDefault: true,
+			},
+			expectedConfig: map[string]interface{}{
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"default_runtime_name": runtimeName,
+							"runtimes": map[string]interface{}{
+								"kata": map[string]interface{}{
+									"pod_annotations":                 []string{"io.katacontainers.*"},
+									"privileged_without_host_devices": true,
+									"runtime_type":                    "io.containerd.kata-qemu-snp.v2",
+									"options": map[string]interface{}{
+										"ConfigPath": kataConfigPath,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "all runtime class options",
+			runtimeName: runtimeName,
+			options: runtime.RuntimeClassOptions{
+				RuntimeType:                  "io.containerd.kata-qemu-snp.v2",
+				RuntimePath:                  "/opt/kata/bin/containerd-shim-kata-v2",
+				Snapshotter:                  "nydus",
+				PodAnnotations:               []string{"io.katacontainers.config.hypervisor.*"},
+				ContainerAnnotations:         []string{"io.katacontainers.container.*"},
+				SandboxMode:                  "shim",
+				PrivilegedWithoutHostDevices: ptr.To(false),
+				SystemdCgroup:                ptr.To(true),
+				CgroupWritable:               ptr.To(true),
+			},
+			expectedConfig: map[string]interface{}{
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{
+								"kata": map[string]interface{}{
+									"cgroup_writable":                 true,
+									"container_annotations":           []string{"io.katacontainers.container.*"},
+									"pod_annotations":                 []string{"io.katacontainers.config.hypervisor.*"},
+									"privileged_without_host_devices": false,
+									"runtime_path":                    "/opt/kata/bin/containerd-shim-kata-v2",
+									"runtime_type":                    "io.containerd.kata-qemu-snp.v2",
+									"sandbox_mode":                    "shim",
+									"snapshotter":                     "nydus",
+									"options": map[string]interface{}{
+										"ConfigPath":    kataConfigPath,
+										"SystemdCgroup": true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testcases {
-		config, err := toml.TreeFromMap(map[string]interface{}{
-			"plugins": map[string]interface{}{
-				"io.containerd.grpc.v1.cri": map[string]interface{}{
-					"containerd": map[string]interface{}{
-						"runtimes": map[string]interface{}{},
+		t.Run(tc.description, func(t *testing.T) {
+			config, err := toml.TreeFromMap(map[string]interface{}{
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{},
+						},
 					},
 				},
-			},
+			})
+			require.NoError(t, err)
+			ctrdConfig := Config{
+				Tree:        config,
+				RuntimeType: runtimeType,
+				PodAnnotations: []string{
+					"io.katacontainers.*",
+				},
+			}
+
+			err = ctrdConfig.AddRuntime(tc.runtimeName, kataConfigPath, tc.options)
+			require.NoError(t, err)
+
+			expected, err := toml.TreeFromMap(tc.expectedConfig)
+			require.NoError(t, err)
+			require.Equal(t, expected.String(), config.String())
 		})
-		require.NoError(t, err)
-		ctrdConfig := Config{
-			Tree:        config,
-			RuntimeType: runtimeType,
-			PodAnnotations: []string{
-				"io.katacontainers.*",
-			},
-		}
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestConfigVersions(t *testing.T) {
+	const (
+		runtimeName    = "kata-qemu-nvidia-gpu"
+		kataConfigPath = "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu/configuration-kata-qemu-nvidia-gpu.toml"
+	)
 
-		err = ctrdConfig.AddRuntime(tc.runtimeName, kataConfigPath, false)
+	testCases := []struct {
+		description     string
+		config          string
+		golden          string
+		expectedVersion int64
+		options         []Option
+		runtimeOptions  runtime.RuntimeClassOptions
+	}{
+		{
+			description:     "version 1",
+			config:          "config-v1.toml",
+			golden:          "config-v1.golden.toml",
+			expectedVersion: 1,
+		},
+		{
+			description:     "version 1 with legacy default runtime",
+			config:          "config-v1.toml",
+			golden:          "config-v1-legacy.golden.toml",
+			expectedVersion: 1,
+			options:         []Option{WithUseLegacyConfig(true)},
+			runtimeOptions:  runtime.RuntimeClassOptions{SetAsDefault: true},
+		},
+		{
+			description:     "version 2",
+			config:          "config-v2.toml",
+			golden:          "config-v2.golden.toml",
+			expectedVersion: 2,
+		},
+		{
+			description:     "version 3",
+			config:          "config-v3.toml",
+			golden:          "config-v3.golden.toml",
+			expectedVersion: 3,
+		},
+		{
+			description:     "new config",
+			config:          "does-not-exist.toml",
+			golden:          "config-new.golden.toml",
+			expectedVersion: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			opts := append([]Option{
+				WithPath(filepath.Join("testdata", tc.config)),
+				WithRuntimeType("io.containerd.kata.v2"),
+				WithPodAnnotations("io.katacontainers.*"),
+			}, tc.options...)
+			c, err := New(opts...)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedVersion, c.Version)
+			original := c.String()
+
+			require.NoError(t, c.AddRuntime(runtimeName, kataConfigPath, tc.runtimeOptions))
+
+			output, err := c.ToTomlString()
+			require.NoError(t, err)
+
+			goldenPath := filepath.Join("testdata", tc.golden)
+			if *update {
+				require.NoError(t, os.WriteFile(goldenPath, []byte(output), 0600))
+			}
+			golden, err := os.ReadFile(goldenPath)
+			require.NoError(t, err)
+			require.Equal(t, string(golden), output)
+
+			require.NoError(t, c.RemoveRuntime(runtimeName))
+			if _, err := os.Stat(filepath.Join("testdata", tc.config)); err == nil {
+				require.Equal(t, original, c.String())
+			} else {
+				require.Empty(t, c.Keys())
+			}
+		})
+	}
+}
+
+func TestConfig_RollbackRestoresPreviousSave(t *testing.T) {
+	const original = `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "runc"
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	backupDir := filepath.Join(dir, "backups")
+	require.NoError(t, os.WriteFile(configPath, []byte(original), 0600))
+
+	newConfig := func() *Config {
+		c, err := New(
+			WithPath(configPath),
+			WithBackupDir(backupDir),
+		)
 		require.NoError(t, err)
+		return c
+	}
+
+	c := newConfig()
+	require.NoError(t, c.AddRuntime("kata", "/opt/nvidia/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err := c.Save()
+	require.NoError(t, err)
+
+	// Another tool edits the config after kata manager first modified it
+	installed, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	edited := string(installed) + "\n[debug]\n  level = \"debug\"\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(edited), 0600))
+
+	// A failed run only reverts its own changes
+	c = newConfig()
+	require.NoError(t, c.AddRuntime("kata-snp", "/opt/nvidia/kata/configuration-snp.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.NoError(t, c.Rollback())
 
-		expected, err := toml.TreeFromMap(tc.expectedConfig)
+	config, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	require.Equal(t, edited, string(config))
+
+	// The backup of the original config is kept for cleanup
+	b, err := backup.Load(backupDir, configPath)
+	require.NoError(t, err)
+	require.NotNil(t, b)
+	require.True(t, b.Matches([]byte(original)))
+
+	// The ownership records of the previous save are restored as well
+	c = newConfig()
+	require.NoError(t, c.RemoveRuntime("kata"))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	config, err = os.ReadFile(configPath)
+	require.NoError(t, err)
+	equal, err := runtime.Equivalent([]byte(original+"\n[debug]\n  level = \"debug\"\n"), config)
+	require.NoError(t, err)
+	require.True(t, equal, "unexpected config:\n%s", config)
+}
+
+func TestConfig_Restart(t *testing.T) {
+	testCases := []struct {
+		description   string
+		ready         bool
+		expectedError bool
+	}{
+		{
+			description: "runtime becomes ready",
+			ready:       true,
+		},
+		{
+			description:   "runtime never becomes ready",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			fakeRuntime := &fake.Runtime{Ready: tc.ready}
+			socket := filepath.Join(t.TempDir(), "containerd.sock")
+			require.NoError(t, fakeRuntime.Serve(socket))
+			defer fakeRuntime.Close()
+
+			restarter, err := restart.New(restart.Options{Strategy: restart.None, Socket: socket})
+			require.NoError(t, err)
+
+			c, err := New(
+				WithPath(filepath.Join(t.TempDir(), "config.toml")),
+				WithSocket(socket),
+				WithRestarter(restarter),
+			)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			err = c.Restart(ctx)
+			if tc.expectedError {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_RemoveRuntimeRestoresPreExisting(t *testing.T) {
+	const original = `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "runc"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.kata]
+    runtime_type = "io.containerd.kata.v2"
+    pod_annotations = ["io.katacontainers.config.hypervisor.*"]
+
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.kata.options]
+      ConfigPath = "/opt/kata/share/defaults/kata-containers/configuration.toml"
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(original), 0600))
+
+	newConfig := func() *Config {
+		c, err := New(
+			WithPath(configPath),
+			WithBackupDir(filepath.Join(dir, "backups")),
+			WithPodAnnotations("io.katacontainers.*"),
+		)
 		require.NoError(t, err)
-		require.Equal(t, expected.String(), config.String())
+		return c
 	}
+
+	c := newConfig()
+	require.NoError(t, c.AddRuntime("kata", "/opt/nvidia/kata/configuration.toml", runtime.RuntimeClassOptions{SetAsDefault: true}))
+	require.NoError(t, c.AddRuntime("kata-snp", "/opt/nvidia/kata/configuration-snp.toml", runtime.RuntimeClassOptions{}))
+	_, err := c.Save()
+	require.NoError(t, err)
+
+	// The runtimes are removed by a later run of kata manager
+	c = newConfig()
+	require.Equal(t, "kata", c.DefaultRuntime())
+	require.NoError(t, c.RemoveRuntime("kata"))
+	require.NoError(t, c.RemoveRuntime("kata-snp"))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	config, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	equal, err := runtime.Equivalent([]byte(original), config)
+	require.NoError(t, err)
+	require.True(t, equal, "unexpected config:\n%s", config)
 }
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package containerd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pelletier/go-toml"
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+)
+
+// withDropIn switches the config to drop-in mode. The receiver holds the main
+// config; the returned config holds the drop-in file, which uses the same config
+// version as the main config. Drop-in files require config version 3: containerd
+// 1.x replaces a whole plugin section of the main config with the section of an
+// imported file, dropping settings such as the sandbox image, while containerd 2.x
+// merges the sections.
+func (c *Config) withDropIn(dropInPath string) (*Config, error) {
+	if c.Version < 3 {
+		return &Config{}, fmt.Errorf("drop-in configs require containerd config version 3, found version %d", c.Version)
+	}
+
+	dropIn, err := loadConfig(dropInPath)
+	if err != nil {
+		return &Config{}, fmt.Errorf("failed to load drop-in config: %w", err)
+	}
+	dropIn.Set("version", c.Version)
+
+	dropIn.Version = c.Version
+	dropIn.RuntimeType = c.RuntimeType
+	dropIn.UseDefaultRuntimeName = c.UseDefaultRuntimeName
+	dropIn.PodAnnotations = c.PodAnnotations
+	dropIn.Path = dropInPath
+	dropIn.Socket = c.Socket
+	dropIn.ImportedBy = c.Path
+	dropIn.BackupDir = c.BackupDir
+	dropIn.Restarter = c.Restarter
+	dropIn.HostRoot = c.HostRoot
+
+	dropIn.owned, err = ownership.Load(c.BackupDir, c.HostRoot.HostPath(dropInPath))
+	if err != nil {
+		return &Config{}, err
+	}
+
+	return dropIn, nil
+}
+
+// importPath returns the entry added to the imports of the main config, which is the
+// path of the drop-in file on the host, as it is resolved by containerd. Containerd
+// fails to start if an imported file is missing, so the entry is removed along with
+// the drop-in file.
+func (c *Config) importPath() string {
+	return c.HostRoot.HostPath(c.Path)
+}
+
+// ensureImported adds the import path to the imports of the config at path if it is
+// not imported yet.
+func ensureImported(path string, importPath string, version int64) error {
+	content, err := runtime.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	output, err := importConfig(content, importPath, version)
+	if err != nil {
+		return fmt.Errorf("unable to update '%s': %w", path, err)
+	}
+	if bytes.Equal(content, output) {
+		return nil
+	}
+
+	klog.Infof("Adding %v to the imports of %v", importPath, path)
+	return os.WriteFile(path, output, 0644)
+}
+
+// ensureNotImported removes the import path from the imports of the config at path
+// if it is imported.
+func ensureNotImported(path string, importPath string) error {
+	content, err := runtime.ReadFile(path)
+	if err != nil || content == nil {
+		return err
+	}
+
+	output, err := unimportConfig(content, importPath)
+	if err != nil {
+		return fmt.Errorf("unable to update '%s': %w", path, err)
+	}
+	if bytes.Equal(content, output) {
+		return nil
+	}
+
+	klog.Infof("Removing %v from the imports of %v", importPath, path)
+	return os.WriteFile(path, output, 0644)
+}
+
+// importConfig returns the content of a config importing the import path. When the
+// config has no imports, the entry is prepended to the content as is, leaving the
+// formatting and comments of the config untouched.
+func importConfig(content []byte, importPath string, version int64) ([]byte, error) {
+	config, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+
+	if !config.Has("imports") {
+		var output bytes.Buffer
+		if len(config.Keys()) == 0 {
+			fmt.Fprintf(&output, "version = %d\n", version)
+		}
+		fmt.Fprintf(&output, "imports = [%q]\n", importPath)
+		output.Write(content)
+		return output.Bytes(), nil
+	}
+
+	imports, ok := config.Get("imports").([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for imports", config.Get("imports"))
+	}
+	for _, i := range imports {
+		if i == importPath {
+			return content, nil
+		}
+	}
+
+	config.Set("imports", append(imports, importPath))
+	output, err := config.ToTomlString()
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert to TOML: %w", err)
+	}
+	return []byte(output), nil
+}
+
+// unimportConfig returns the content of a config no longer importing the import
+// path. An entry prepended by importConfig is removed as is, leaving the formatting
+// and comments of the config untouched.
+func unimportConfig(content []byte, importPath string) ([]byte, error) {
+	config, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+	if !config.Has("imports") {
+		return content, nil
+	}
+
+	imports, ok := config.Get("imports").([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for imports", config.Get("imports"))
+	}
+	var kept []interface{}
+	for _, i := range imports {
+		if i != importPath {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == len(imports) {
+		return content, nil
+	}
+
+	entry := []byte(fmt.Sprintf("imports = [%q]\n", importPath))
+	if len(kept) == 0 && bytes.Contains(content, entry) {
+		return bytes.Replace(content, entry, nil, 1), nil
+	}
+	if len(kept) == 0 {
+		err = config.Delete("imports")
+	} else {
+		config.Set("imports", kept)
+	}
+	if err != nil {
+		return nil, err
+	}
+	output, err := config.ToTomlString()
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert to TOML: %w", err)
+	}
+	return []byte(output), nil
+}
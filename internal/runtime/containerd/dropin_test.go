@@ -0,0 +1,306 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package containerd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+)
+
+func TestDropIn(t *testing.T) {
+	const (
+		runtimeName    = "kata-qemu-nvidia-gpu"
+		kataConfigPath = "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu/configuration-kata-qemu-nvidia-gpu.toml"
+	)
+
+	testCases := []struct {
+		description    string
+		config         string
+		expectedConfig string
+		// expectedRemoved is the main config once the drop-in file is removed
+		expectedRemoved string
+	}{
+		{
+			description: "config without imports",
+			config: `# managed by cloud-init
+version = 3
+
+[plugins."io.containerd.cri.v1.runtime".containerd]
+  default_runtime_name = "runc"
+`,
+			expectedConfig: `imports = ["%s"]
+# managed by cloud-init
+version = 3
+
+[plugins."io.containerd.cri.v1.runtime".containerd]
+  default_runtime_name = "runc"
+`,
+			expectedRemoved: `# managed by cloud-init
+version = 3
+
+[plugins."io.containerd.cri.v1.runtime".containerd]
+  default_runtime_name = "runc"
+`,
+		},
+		{
+			description: "config with other imports",
+			config: `version = 3
+imports = ["/etc/containerd/nvidia.toml"]
+`,
+			expectedConfig: `imports = ["/etc/containerd/nvidia.toml", "%s"]
+version = 3
+`,
+			expectedRemoved: `imports = ["/etc/containerd/nvidia.toml"]
+version = 3
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.toml")
+			dropInPath := filepath.Join(dir, "conf.d", "99-nvidia-kata.toml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tc.config), 0600))
+
+			c, err := New(
+				WithPath(configPath),
+				WithDropInPath(dropInPath),
+				WithRuntimeType("io.containerd.kata.v2"),
+				WithPodAnnotations("io.katacontainers.*"),
+			)
+			require.NoError(t, err)
+
+			require.NoError(t, c.AddRuntime(runtimeName, kataConfigPath, runtime.RuntimeClassOptions{}))
+			_, err = c.Save()
+			require.NoError(t, err)
+			// saving again must not import the drop-in config twice
+			_, err = c.Save()
+			require.NoError(t, err)
+			require.True(t, c.unchanged)
+
+			expectedConfig := fmt.Sprintf(tc.expectedConfig, dropInPath)
+			config, err := os.ReadFile(configPath)
+			require.NoError(t, err)
+			require.Equal(t, expectedConfig, string(config))
+
+			dropIn, err := os.ReadFile(dropInPath)
+			require.NoError(t, err)
+			golden, err := os.ReadFile(filepath.Join("testdata", "config-dropin.golden.toml"))
+			require.NoError(t, err)
+			require.Equal(t, string(golden), string(dropIn))
+
+			require.NoError(t, c.RemoveRuntime(runtimeName))
+			n, err := c.Save()
+			require.NoError(t, err)
+			require.Zero(t, n)
+			require.NoFileExists(t, dropInPath)
+
+			// The drop-in file is no longer imported, as containerd fails to start
+			// with a missing import
+			config, err = os.ReadFile(configPath)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedRemoved, string(config))
+			_, err = c.Save()
+			require.NoError(t, err)
+			require.True(t, c.unchanged)
+		})
+	}
+}
+
+func TestDropInRequiresVersion3(t *testing.T) {
+	testCases := []struct {
+		description string
+		path        string
+	}{
+		{
+			description: "version 1",
+			path:        filepath.Join("testdata", "config-v1.toml"),
+		},
+		{
+			description: "version 2",
+			path:        filepath.Join("testdata", "config-v2.toml"),
+		},
+		{
+			description: "missing config",
+			path:        filepath.Join(t.TempDir(), "config.toml"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := New(
+				WithPath(tc.path),
+				WithDropInPath(filepath.Join(t.TempDir(), "99-nvidia-kata.toml")),
+			)
+			require.ErrorContains(t, err, "require containerd config version 3")
+		})
+	}
+}
+
+// TestDropInMerge checks that the main config merged with the drop-in file, as done
+// by containerd 2.x, keeps the settings of the main config
+func TestDropInMerge(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	dropInPath := filepath.Join(dir, "conf.d", "99-nvidia-kata.toml")
+	original, err := os.ReadFile(filepath.Join("testdata", "config-v3.toml"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configPath, original, 0600))
+
+	c, err := New(
+		WithPath(configPath),
+		WithDropInPath(dropInPath),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.AddRuntime("kata", "/opt/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	merged, err := toml.LoadFile(configPath)
+	require.NoError(t, err)
+	dropIn, err := toml.LoadFile(dropInPath)
+	require.NoError(t, err)
+	mergeTree(merged, dropIn)
+
+	require.Equal(t, "overlayfs", merged.GetPath([]string{"plugins", "io.containerd.cri.v1.images", "snapshotter"}))
+	runtimes := []string{"plugins", "io.containerd.cri.v1.runtime", "containerd", "runtimes"}
+	require.Equal(t, true, merged.GetPath(append(runtimes, "runc", "options", "SystemdCgroup")))
+	require.Equal(t, "/opt/kata/configuration.toml", merged.GetPath(append(runtimes, "kata", "options", "ConfigPath")))
+	require.Equal(t, "runc", merged.GetPath([]string{"plugins", "io.containerd.cri.v1.runtime", "containerd", "default_runtime_name"}))
+}
+
+// mergeTree merges src into dst the way containerd 2.x merges imported configs:
+// tables are merged recursively and other values of src replace those of dst
+func mergeTree(dst *toml.Tree, src *toml.Tree) {
+	for _, key := range src.Keys() {
+		srcTree, srcIsTree := src.GetPath([]string{key}).(*toml.Tree)
+		dstTree, dstIsTree := dst.GetPath([]string{key}).(*toml.Tree)
+		if srcIsTree && dstIsTree {
+			mergeTree(dstTree, srcTree)
+			continue
+		}
+		dst.SetPath([]string{key}, src.GetPath([]string{key}))
+	}
+}
+
+func TestDropInRollback(t *testing.T) {
+	const original = `version = 3
+
+[plugins."io.containerd.cri.v1.runtime".containerd]
+  default_runtime_name = "runc"
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	dropInPath := filepath.Join(dir, "conf.d", "99-nvidia-kata.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(original), 0600))
+
+	c, err := New(
+		WithPath(configPath),
+		WithDropInPath(dropInPath),
+		WithBackupDir(filepath.Join(dir, "backups")),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.AddRuntime("kata", "/opt/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.FileExists(t, dropInPath)
+
+	require.NoError(t, c.Rollback())
+	require.NoFileExists(t, dropInPath)
+	config, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	require.Equal(t, original, string(config))
+}
+
+func TestDropInHostRoot(t *testing.T) {
+	root := host.Root(t.TempDir())
+	configPath := root.Path("/etc/containerd/config.toml")
+	dropInPath := root.Path("/etc/containerd/conf.d/99-nvidia-kata.toml")
+	backupDir := root.Path("/opt/artifacts/.backups")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configPath), 0755))
+	require.NoError(t, os.WriteFile(configPath, []byte("version = 3\n"), 0600))
+
+	c, err := New(
+		WithPath(configPath),
+		WithDropInPath(dropInPath),
+		WithBackupDir(backupDir),
+		WithHostRoot(string(root)),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.AddRuntime("kata", "/opt/artifacts/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	// The import and the backups refer to the paths on the host
+	config, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	require.Equal(t, "imports = [\"/etc/containerd/conf.d/99-nvidia-kata.toml\"]\nversion = 3\n", string(config))
+	require.FileExists(t, filepath.Join(backupDir, "etc_containerd_config.toml.json"))
+	require.FileExists(t, filepath.Join(backupDir, "etc_containerd_conf.d_99-nvidia-kata.toml.json"))
+
+	require.NoError(t, c.Rollback())
+	require.NoFileExists(t, dropInPath)
+	config, err = os.ReadFile(configPath)
+	require.NoError(t, err)
+	require.Equal(t, "version = 3\n", string(config))
+}
+
+func TestDropInChanges(t *testing.T) {
+	const original = `version = 3
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	dropInPath := filepath.Join(dir, "conf.d", "99-nvidia-kata.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(original), 0600))
+
+	c, err := New(
+		WithPath(configPath),
+		WithDropInPath(dropInPath),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.AddRuntime("kata", "/opt/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+
+	changes, err := c.Changes()
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	require.Equal(t, configPath, changes[0].Path)
+	require.Equal(t, original, string(changes[0].Old))
+	require.Equal(t, fmt.Sprintf("imports = [%q]\n%s", dropInPath, original), string(changes[0].New))
+
+	require.Equal(t, dropInPath, changes[1].Path)
+	require.Nil(t, changes[1].Old)
+	require.Contains(t, string(changes[1].New), "[plugins.\"io.containerd.cri.v1.runtime\".containerd.runtimes.kata]")
+	require.True(t, changes[1].Changed())
+
+	// Nothing is written to disk
+	config, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	require.Equal(t, original, string(config))
+	require.NoFileExists(t, dropInPath)
+}
@@ -22,18 +22,30 @@ import (
 
 	"github.com/pelletier/go-toml"
 	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 )
 
 const (
 	defaultRuntimeType = "io.containerd.runc.v2"
+
+	// defaultConfigVersion is the config version used for new config files. Version 2
+	// configs are understood by containerd 1.x and migrated by containerd 2.x.
+	defaultConfigVersion = 2
 )
 
 type builder struct {
 	path            string
+	dropInPath      string
 	runtimeType     string
 	useLegacyConfig bool
 	podAnnotations  []string
 	socket          string
+	backupDir       string
+	restarter       restart.Strategy
+	hostRoot        host.Root
 }
 
 // Option defines a function that can be used to configure the config builder
@@ -46,6 +58,15 @@ func WithPath(path string) Option {
 	}
 }
 
+// WithDropInPath sets the path of a drop-in config file for the config builder.
+// When set, runtimes are written to the drop-in file, which is imported by the
+// config at the path set through WithPath, instead of to that config itself.
+func WithDropInPath(dropInPath string) Option {
+	return func(b *builder) {
+		b.dropInPath = dropInPath
+	}
+}
+
 // WithRuntimeType sets the runtime type for the config builder
 func WithRuntimeType(runtimeType string) Option {
 	return func(b *builder) {
@@ -53,7 +74,9 @@ func WithRuntimeType(runtimeType string) Option {
 	}
 }
 
-// WithUseLegacyConfig sets the useLegacyConfig flag for the config builder
+// WithUseLegacyConfig sets the useLegacyConfig flag for the config builder.
+// For version 1 configs, this sets the default runtime through the legacy
+// default_runtime table instead of default_runtime_name.
 func WithUseLegacyConfig(useLegacyConfig bool) Option {
 	return func(b *builder) {
 		b.useLegacyConfig = useLegacyConfig
@@ -74,6 +97,28 @@ func WithSocket(socket string) Option {
 	}
 }
 
+// WithBackupDir sets the directory in which the original config files are backed up
+func WithBackupDir(backupDir string) Option {
+	return func(b *builder) {
+		b.backupDir = backupDir
+	}
+}
+
+// WithRestarter sets the restart strategy for the config builder
+func WithRestarter(restarter restart.Strategy) Option {
+	return func(b *builder) {
+		b.restarter = restarter
+	}
+}
+
+// WithHostRoot sets the path the host root filesystem is mounted at. The config
+// paths are local paths below it.
+func WithHostRoot(hostRoot string) Option {
+	return func(b *builder) {
+		b.hostRoot = host.Root(hostRoot)
+	}
+}
+
 func (b *builder) build() (*Config, error) {
 	if b.path == "" {
 		return &Config{}, fmt.Errorf("config path is empty")
@@ -87,11 +132,24 @@ func (b *builder) build() (*Config, error) {
 	if err != nil {
 		return &Config{}, fmt.Errorf("failed to load config: %w", err)
 	}
+	config.Version = configVersion(config.Tree)
 	config.RuntimeType = b.runtimeType
 	config.UseDefaultRuntimeName = !b.useLegacyConfig
 	config.PodAnnotations = b.podAnnotations
 	config.Path = b.path
 	config.Socket = b.socket
+	config.BackupDir = b.backupDir
+	config.Restarter = b.restarter
+	config.HostRoot = b.hostRoot
+
+	if b.dropInPath != "" {
+		return config.withDropIn(b.dropInPath)
+	}
+
+	config.owned, err = ownership.Load(b.backupDir, b.hostRoot.HostPath(b.path))
+	if err != nil {
+		return &Config{}, err
+	}
 
 	return config, nil
 }
@@ -118,8 +176,28 @@ func loadConfig(config string) (*Config, error) {
 
 	klog.Infof("Successfully loaded config")
 
+	if len(tomlConfig.Keys()) == 0 {
+		tomlConfig.Set("version", int64(defaultConfigVersion))
+	}
+
 	cfg := Config{
 		Tree: tomlConfig,
 	}
 	return &cfg, nil
 }
+
+// configVersion returns the version of a containerd config. Configs without a
+// version field are version 1 for containerd; a CRI plugin section using the
+// fully qualified plugin ID of a later version takes precedence though.
+func configVersion(config *toml.Tree) int64 {
+	if version, ok := config.Get("version").(int64); ok {
+		return version
+	}
+	switch {
+	case config.HasPath([]string{"plugins", "io.containerd.cri.v1.runtime"}):
+		return 3
+	case config.HasPath([]string{"plugins", "io.containerd.grpc.v1.cri"}):
+		return 2
+	}
+	return 1
+}
@@ -1,122 +0,0 @@
-/*
- * Copyright (c) NVIDIA CORPORATION.  All rights reserved.
- *
- * Licensed under the Apache License, Version 2.0 (the "License");
- * you may not use this file except in compliance with the License.
- * You may obtain a copy of the License at
- *
- *     http://www.apache.org/licenses/LICENSE-2.0
- *
- * Unless required by applicable law or agreed to in writing, software
- * distributed under the License is distributed on an "AS IS" BASIS,
- * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
- * See the License for the specific language governing permissions and
- * limitations under the License.
- */
-
-package containerd
-
-import (
-	"fmt"
-	"net"
-	"syscall"
-	"time"
-
-	"k8s.io/klog/v2"
-)
-
-const (
-	reloadBackoff     = 5 * time.Second
-	maxReloadAttempts = 6
-
-	socketMessageToGetPID = ""
-)
-
-// RestartContainerd restarts containerd by sending a SIGHUP signal to the containerd daeon
-func RestartContainerd(socket string) error {
-	err := signalContainerd(socket)
-	if err != nil {
-		return fmt.Errorf("unable to signal containerd: %w", err)
-	}
-
-	return nil
-}
-
-// signalContainerd sends a SIGHUP signal to the containerd daemon
-func signalContainerd(socket string) error {
-	klog.Infof("Sending SIGHUP signal to containerd")
-
-	// Wrap the logic to perform the SIGHUP in a function, so we can retry it on failure
-	retriable := func() error {
-		conn, err := net.Dial("unix", socket)
-		if err != nil {
-			return fmt.Errorf("unable to dial: %w", err)
-		}
-		defer conn.Close()
-
-		sconn, err := conn.(*net.UnixConn).SyscallConn()
-		if err != nil {
-			return fmt.Errorf("unable to get syscall connection: %w", err)
-		}
-
-		socketErr := sconn.Control(func(fd uintptr) {
-			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
-		})
-		if socketErr != nil {
-			return fmt.Errorf("unable to issue call on socket fd: %w", socketErr)
-		}
-		if err != nil {
-			return fmt.Errorf("unable to SetsockoptInt on socket fd: %w", err)
-		}
-
-		_, _, err = conn.(*net.UnixConn).WriteMsgUnix([]byte(socketMessageToGetPID), nil, nil)
-		if err != nil {
-			return fmt.Errorf("unable to WriteMsgUnix on socket fd: %w", err)
-		}
-
-		oob := make([]byte, 1024)
-		_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(nil, oob)
-		if err != nil {
-			return fmt.Errorf("unable to ReadMsgUnix on socket fd: %w", err)
-		}
-
-		oob = oob[:oobn]
-		scm, err := syscall.ParseSocketControlMessage(oob)
-		if err != nil {
-			return fmt.Errorf("unable to ParseSocketControlMessage from message received on socket fd: %v", err)
-		}
-
-		ucred, err := syscall.ParseUnixCredentials(&scm[0])
-		if err != nil {
-			return fmt.Errorf("unable to ParseUnixCredentials from message received on socket fd: %w", err)
-		}
-
-		err = syscall.Kill(int(ucred.Pid), syscall.SIGHUP)
-		if err != nil {
-			return fmt.Errorf("unable to send SIGHUP to 'containerd' process: %w", err)
-		}
-
-		return nil
-	}
-
-	// Try to send a SIGHUP up to maxReloadAttempts times
-	var err error
-	for i := 0; i < maxReloadAttempts; i++ {
-		err = retriable()
-		if err == nil {
-			break
-		}
-		if i == maxReloadAttempts-1 {
-			break
-		}
-		klog.Warningf("Error signaling containerd, attempt %v/%v: %v", i+1, maxReloadAttempts, err)
-		time.Sleep(reloadBackoff)
-	}
-	if err != nil {
-		klog.Warningf("Max retries reached %v/%v, aborting", maxReloadAttempts, maxReloadAttempts)
-		return err
-	}
-
-	klog.Infof("Successfully signaled containerd")
-	return nil
-}
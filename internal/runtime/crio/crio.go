@@ -17,25 +17,56 @@
 package crio
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/pelletier/go-toml"
 	"k8s.io/klog/v2"
 
 	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
 
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/metrics"
 	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 )
 
-// Config represents the crio config
+// Config represents a crio drop-in config holding the kata runtimes
 type Config struct {
 	*toml.Tree
+	// Merged is the effective crio config as reported by 'crio status config'. It is
+	// used to inherit the options of existing runtimes and is never written back.
+	Merged                *toml.Tree
 	RuntimeType           string
 	UseDefaultRuntimeName bool
 	PodAnnotations        []string
 	Path                  string
+	// BackupDir is the directory in which the original drop-in file is backed up
+	// before it is first modified; no backup is taken if it is empty.
+	BackupDir string
+	Socket    string
+	// Restarter restarts crio; the crio systemd unit is restarted if it is nil
+	Restarter restart.Strategy
+	// HostRoot is the path the host root filesystem is mounted at
+	HostRoot host.Root
+	// Executor runs operations on the host
+	Executor host.Executor
+
+	// owned tracks the keys created or changed by kata manager, so that removing a
+	// runtime restores pre-existing settings
+	owned *ownership.Records
+	// checkpoint holds the content of the drop-in file and ownership records before
+	// the last Save
+	checkpoint *backup.Checkpoint
+	// unchanged is set when the last Save found the drop-in file to already hold
+	// the rendered config, in which case crio is not restarted
+	unchanged bool
 }
 
 func Setup(o *runtime.Options) (runtime.Runtime, error) {
@@ -43,6 +74,11 @@ func Setup(o *runtime.Options) (runtime.Runtime, error) {
 		WithPath(o.Path),
 		WithPodAnnotations(o.PodAnnotations...),
 		WithRuntimeType(o.RuntimeType),
+		WithBackupDir(o.BackupDir),
+		WithSocket(o.Socket),
+		WithRestarter(o.Restarter),
+		WithHostRoot(o.HostRoot),
+		WithHostExecutor(o.Executor),
 	)
 	return crioConfig, err
 }
@@ -58,31 +94,74 @@ func New(opts ...Option) (*Config, error) {
 }
 
 // AddRuntime adds a runtime to the crio config
-func (c *Config) AddRuntime(runtimeName string, path string, setAsDefault bool) error {
+func (c *Config) AddRuntime(runtimeName string, path string, opts runtime.RuntimeClassOptions) error {
 	if c == nil {
 		return fmt.Errorf("config is nil")
 	}
 
 	config := *c.Tree
+	merged := c.Merged
+	if merged == nil {
+		merged = c.Tree
+	}
+
+	if err := c.owned.Track(&config, "crio", "runtime", "runtimes", runtimeName); err != nil {
+		return err
+	}
+
+	runtimeType := c.RuntimeType
+	if runtimeType == "" {
+		runtimeType = defaultRuntimeType
+	}
+	if slices.Contains(runtimeTypes, opts.RuntimeType) {
+		runtimeType = opts.RuntimeType
+	}
 
 	// By default we extract the runtime options from the crun settings; if this does not exist we get the options from the default runtime specified in the config.
 	runtimeNamesForConfig := []string{api.DefaultCrioRuntime}
-	if defaultRuntimeName, ok := config.GetPath([]string{"crio", "runtime", "default_runtime"}).(string); ok && defaultRuntimeName != "" {
+	if defaultRuntimeName, ok := merged.GetPath([]string{"crio", "runtime", "default_runtime"}).(string); ok && defaultRuntimeName != "" {
 		runtimeNamesForConfig = append(runtimeNamesForConfig, defaultRuntimeName)
 	}
 	for _, r := range runtimeNamesForConfig {
-		if options, ok := config.GetPath([]string{"crio", "runtime", "runtimes", r}).(*toml.Tree); ok {
-			options, _ = toml.Load(options.String())
+		if options, ok := merged.GetPath([]string{"crio", "runtime", "runtimes", r}).(*toml.Tree); ok {
+			options, err := inheritedOptions(options, runtimeType)
+			if err != nil {
+				return fmt.Errorf("failed to load options of runtime %s: %w", r, err)
+			}
 			config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName}, options)
 			break
 		}
 	}
+	for _, option := range unsupportedOptions(opts) {
+		klog.Warningf("Ignoring %s of runtime class %s, it is unsupported for cri-o", option, runtimeName)
+	}
+	runtimePath := defaultKataShimPath
+	if opts.RuntimePath != "" {
+		runtimePath = opts.RuntimePath
+	}
+	privilegedWithoutHostDevices := true
+	if opts.PrivilegedWithoutHostDevices != nil {
+		privilegedWithoutHostDevices = *opts.PrivilegedWithoutHostDevices
+	}
+	podAnnotations := c.PodAnnotations
+	if opts.PodAnnotations != nil {
+		podAnnotations = opts.PodAnnotations
+	}
 
-	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_path"}, path)
-	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_type"}, "vm")
-	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "privileged_without_host_devices"}, "true")
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_path"}, runtimePath)
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_type"}, runtimeType)
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_root"}, defaultKataRuntimeRoot)
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "runtime_config_path"}, path)
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "privileged_without_host_devices"}, privilegedWithoutHostDevices)
+	config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "allowed_annotations"}, allowedAnnotations(podAnnotations, opts.ContainerAnnotations))
+	if opts.MonitorCgroup != "" {
+		config.SetPath([]string{"crio", "runtime", "runtimes", runtimeName, "monitor_cgroup"}, opts.MonitorCgroup)
+	}
 
-	if setAsDefault {
+	if opts.SetAsDefault {
+		if err := c.owned.Track(&config, "crio", "runtime", "default_runtime"); err != nil {
+			return err
+		}
 		config.SetPath([]string{"crio", "runtime", "default_runtime"}, runtimeName)
 	}
 
@@ -90,6 +169,67 @@ func (c *Config) AddRuntime(runtimeName string, path string, setAsDefault bool)
 	return nil
 }
 
+// inheritedOptions returns a copy of the options of an existing runtime to be used
+// for a runtime of the runtime type. Runtimes of type vm are run by the kata shim
+// rather than by conmon and an OCI runtime, so only the options applying to any
+// runtime type are inherited for them.
+func inheritedOptions(options *toml.Tree, runtimeType string) (*toml.Tree, error) {
+	inherited, err := toml.Load(options.String())
+	if err != nil || runtimeType != "vm" {
+		return inherited, err
+	}
+	for _, key := range inherited.Keys() {
+		if !slices.Contains(vmRuntimeOptions, key) {
+			if err := inherited.Delete(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return inherited, nil
+}
+
+// unsupportedOptions returns the runtime class options which have no equivalent in
+// the runtime config of CRI-O. The cgroup manager is configured globally in CRI-O,
+// and the other options are specific to containerd.
+func unsupportedOptions(opts runtime.RuntimeClassOptions) []string {
+	var unsupported []string
+	if opts.RuntimeType != "" && !slices.Contains(runtimeTypes, opts.RuntimeType) {
+		unsupported = append(unsupported, fmt.Sprintf("runtime type %q", opts.RuntimeType))
+	}
+	if opts.Snapshotter != "" {
+		unsupported = append(unsupported, fmt.Sprintf("snapshotter %q", opts.Snapshotter))
+	}
+	if opts.SandboxMode != "" {
+		unsupported = append(unsupported, fmt.Sprintf("sandbox mode %q", opts.SandboxMode))
+	}
+	if opts.SystemdCgroup != nil {
+		unsupported = append(unsupported, fmt.Sprintf("systemdCgroup=%t", *opts.SystemdCgroup))
+	}
+	if opts.CgroupWritable != nil {
+		unsupported = append(unsupported, fmt.Sprintf("cgroup writable=%t", *opts.CgroupWritable))
+	}
+	return unsupported
+}
+
+// allowedAnnotations returns the annotation prefixes allowed for a runtime. CRI-O
+// matches allowed annotations by prefix, so glob patterns such as io.katacontainers.*
+// are converted to the equivalent prefix.
+func allowedAnnotations(annotations ...[]string) []string {
+	allowed := []string{}
+	seen := make(map[string]bool)
+	for _, list := range annotations {
+		for _, a := range list {
+			a = strings.TrimSuffix(a, "*")
+			if a == "" || seen[a] {
+				continue
+			}
+			seen[a] = true
+			allowed = append(allowed, a)
+		}
+	}
+	return allowed
+}
+
 // DefaultRuntime returns the default runtime for the crio config
 func (c *Config) DefaultRuntime() string {
 	if c == nil || c.Tree == nil {
@@ -98,16 +238,36 @@ func (c *Config) DefaultRuntime() string {
 	if runtime, ok := c.GetPath([]string{"crio", "runtime", "default_runtime"}).(string); ok {
 		return runtime
 	}
+	if c.Merged == nil {
+		return ""
+	}
+	if runtime, ok := c.Merged.GetPath([]string{"crio", "runtime", "default_runtime"}).(string); ok {
+		return runtime
+	}
 	return ""
 }
 
-// RemoveRuntime removes a runtime from the crio config
+// RemoveRuntime removes a runtime from the crio config. If kata manager tracks the
+// runtime, the settings it had before they were first changed by kata manager are
+// restored instead.
 func (c *Config) RemoveRuntime(name string) error {
 	if c == nil {
 		return nil
 	}
 
 	config := *c.Tree
+	runtimeClassPath := []string{"crio", "runtime", "runtimes", name}
+	restored, err := c.owned.Restore(&config, runtimeClassPath...)
+	if err != nil {
+		return err
+	}
+	if restored {
+		if _, err := c.owned.Restore(&config, "crio", "runtime", "default_runtime"); err != nil {
+			return err
+		}
+		return c.prune(&config, runtimeClassPath)
+	}
+
 	if runtime, ok := config.GetPath([]string{"crio", "runtime", "default_runtime"}).(string); ok {
 		if runtime == name {
 			err := config.DeletePath([]string{"crio", "runtime", "default_runtime"})
@@ -118,11 +278,18 @@ func (c *Config) RemoveRuntime(name string) error {
 		}
 	}
 
-	runtimeClassPath := []string{"crio", "runtime", "runtimes", name}
-	err := config.DeletePath(runtimeClassPath)
-	if err != nil {
+	if !config.HasPath(runtimeClassPath) {
+		*c.Tree = config
+		return nil
+	}
+	if err := config.DeletePath(runtimeClassPath); err != nil {
 		return err
 	}
+	return c.prune(&config, runtimeClassPath)
+}
+
+// prune removes the tables along the runtime path which have been left empty
+func (c *Config) prune(config *toml.Tree, runtimeClassPath []string) error {
 	for i := 0; i < len(runtimeClassPath); i++ {
 		remainingPath := runtimeClassPath[:len(runtimeClassPath)-i]
 		if entry, ok := config.GetPath(remainingPath).(*toml.Tree); ok {
@@ -136,17 +303,90 @@ func (c *Config) RemoveRuntime(name string) error {
 		}
 	}
 
-	*c.Tree = config
+	*c.Tree = *config
 	return nil
 }
 
-// Save writes the config to the specified path
+// Save writes the drop-in config to the specified path. The drop-in file is
+// removed if it no longer holds any settings, and left untouched if it already
+// holds equivalent settings.
 func (c *Config) Save() (int64, error) {
 	config := c.Tree
 	output, err := config.Marshal()
 	if err != nil {
 		return 0, fmt.Errorf("unable to convert to TOML: %w", err)
 	}
+	if len(config.Keys()) == 0 {
+		output = nil
+	}
+
+	// The file about to be overwritten is checkpointed, so that a failed update is
+	// reverted to the config the runtime ran with before
+	c.checkpoint, err = backup.NewCheckpoint(c.Path, c.owned.Path())
+	if err != nil {
+		return 0, err
+	}
+
+	// The records are persisted first, so that keys changed by an interrupted save
+	// are never mistaken for pre-existing settings
+	if err := c.owned.Save(); err != nil {
+		return 0, err
+	}
+
+	c.unchanged, err = c.isUnchanged(output)
+	if err != nil {
+		return 0, err
+	}
+	if c.unchanged {
+		klog.Infof("Config %v is unchanged, not saving", c.Path)
+		metrics.RuntimeConfigSaves.Inc("unchanged")
+		return int64(len(output)), nil
+	}
+
+	n, err := c.write(output)
+	if err != nil {
+		return 0, err
+	}
+	metrics.RuntimeConfigSaves.Inc("written")
+	return n, nil
+}
+
+// isUnchanged reports whether the drop-in file already holds the rendered config
+func (c *Config) isUnchanged(output []byte) (bool, error) {
+	old, err := runtime.ReadFile(c.Path)
+	if err != nil {
+		return false, err
+	}
+	if old == nil || len(output) == 0 {
+		return old == nil && len(output) == 0, nil
+	}
+	equal, err := runtime.Equivalent(old, output)
+	if err != nil {
+		klog.Warningf("Unable to compare config %v, overwriting it: %v", c.Path, err)
+		return false, nil
+	}
+	return equal, nil
+}
+
+// write writes the rendered config to the drop-in file, or removes the drop-in
+// file if the rendered config is empty
+func (c *Config) write(output []byte) (int64, error) {
+	b, err := c.snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(output) == 0 {
+		err := os.Remove(c.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("unable to remove empty file: %w", err)
+		}
+		return 0, discardIfPristine(b, nil)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return 0, fmt.Errorf("unable to create drop-in directory: %w", err)
+	}
 	f, err := os.Create(c.Path)
 	if err != nil {
 		return 0, fmt.Errorf("unable to open '%s' for writing: %w", c.Path, err)
@@ -158,23 +398,111 @@ func (c *Config) Save() (int64, error) {
 		return 0, fmt.Errorf("unable to write output: %w", err)
 	}
 
-	return int64(n), err
+	return int64(n), discardIfPristine(b, output)
 }
 
-func (c *Config) Restart() error {
-	var args []string
-	args = append(args, "chroot", "/host", "systemctl", "restart", "crio")
+// Changes returns the change Save would make to the drop-in file
+func (c *Config) Changes() ([]runtime.FileChange, error) {
+	old, err := runtime.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	change := runtime.FileChange{Path: c.Path, Old: old}
+	if len(c.Keys()) > 0 {
+		change.New, err = c.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert to TOML: %w", err)
+		}
+	}
+	return []runtime.FileChange{change}, nil
+}
 
-	klog.Infof("Restarting crio using systemd")
+// Unchanged returns true if the last Save found the config to be up to date already
+func (c *Config) Unchanged() bool {
+	return c.unchanged
+}
 
-	// TODO: Can we harden this so that there is less risk of command injection
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+// Rollback restores the drop-in file and ownership records to the content they had
+// before the last Save. The backup of the original file is kept for cleanup, and
+// discarded if the file is back to its original content.
+func (c *Config) Rollback() error {
+	if c.checkpoint == nil {
+		return fmt.Errorf("no saved config to roll back")
+	}
+	// The restored config always has to be picked up by crio
+	c.unchanged = false
+	if err := c.checkpoint.Restore(); err != nil {
+		return err
+	}
+
+	owned, err := ownership.Load(c.BackupDir, c.HostRoot.HostPath(c.Path))
+	if err != nil {
+		return err
+	}
+	c.owned = owned
+
+	if c.BackupDir == "" {
+		return nil
+	}
+	b, err := backup.Load(c.BackupDir, c.HostRoot.HostPath(c.Path))
 	if err != nil {
-		return fmt.Errorf("error restarting crio using systemd: %w", err)
+		return err
+	}
+	content, err := runtime.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+	return discardIfPristine(b, content)
+}
+
+// snapshot backs up the drop-in file unless it has been backed up before
+func (c *Config) snapshot() (*backup.Backup, error) {
+	if c.BackupDir == "" {
+		return nil, nil
+	}
+	b, err := backup.Snapshot(c.BackupDir, c.HostRoot, c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to back up config: %w", err)
+	}
+	return b, nil
+}
+
+// discardIfPristine discards the backup once the file is back to its original content
+func discardIfPristine(b *backup.Backup, content []byte) error {
+	if b == nil || !b.Matches(content) {
+		return nil
+	}
+	return b.Discard()
+}
+
+// Restart restarts crio using the restart strategy of the config
+func (c *Config) Restart(ctx context.Context) error {
+	if c.unchanged {
+		klog.Infof("Config is unchanged, not restarting crio")
+		metrics.RuntimeRestarts.Inc("skipped")
+		return nil
+	}
+
+	restarter := c.Restarter
+	if restarter == nil {
+		var err error
+		restarter, err = restart.New(restart.Options{
+			Strategy: restart.SystemdRestart,
+			Socket:   c.Socket,
+			Unit:     defaultUnit,
+			HostRoot: string(c.HostRoot),
+			Executor: c.Executor,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := restarter.Restart(ctx); err != nil {
+		metrics.RuntimeRestarts.Inc("failed")
+		return fmt.Errorf("error restarting crio: %w", err)
 	}
+	metrics.RuntimeRestarts.Inc("restarted")
 
 	return nil
 }
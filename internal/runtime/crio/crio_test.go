@@ -0,0 +1,449 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crio
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host/fake"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+)
+
+const mergedConfig = `
+[crio]
+  root = "/var/lib/containers/storage"
+
+  [crio.runtime]
+    default_runtime = "crun"
+
+    [crio.runtime.runtimes.crun]
+      container_min_memory = "12MiB"
+      monitor_path = "/usr/libexec/crio/conmon"
+      runtime_path = "/usr/bin/crun"
+      runtime_root = "/run/crun"
+      runtime_type = "oci"
+`
+
+func TestConfig_AddRuntime(t *testing.T) {
+	const (
+		runtimeName    = "kata-qemu-nvidia-gpu"
+		kataConfigPath = "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu/configuration-kata-qemu-nvidia-gpu.toml"
+	)
+
+	testCases := []struct {
+		description    string
+		mergedConfig   map[string]interface{}
+		options        runtime.RuntimeClassOptions
+		expectedConfig map[string]interface{}
+	}{
+		{
+			description: "inherits crun options",
+			mergedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{
+						"default_runtime": "crun",
+						"runtimes": map[string]interface{}{
+							"crun": map[string]interface{}{
+								"container_min_memory": "12MiB",
+								"monitor_path":         "/usr/libexec/crio/conmon",
+								"runtime_path":         "/usr/bin/crun",
+								"runtime_root":         "/run/crun",
+								"runtime_type":         "oci",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{
+						"runtimes": map[string]interface{}{
+							runtimeName: map[string]interface{}{
+								"allowed_annotations":             []string{"io.katacontainers."},
+								"container_min_memory":            "12MiB",
+								"privileged_without_host_devices": true,
+								"runtime_config_path":             kataConfigPath,
+								"runtime_path":                    "/opt/kata/bin/containerd-shim-kata-v2",
+								"runtime_root":                    "/run/vc",
+								"runtime_type":                    "vm",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "inherits default runtime options",
+			mergedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{
+						"default_runtime": "runc",
+						"runtimes": map[string]interface{}{
+							"runc": map[string]interface{}{
+								"monitor_env":  []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin"},
+								"runtime_path": "/usr/bin/runc",
+								"runtime_type": "oci",
+							},
+						},
+					},
+				},
+			},
+			options: runtime.RuntimeClassOptions{
+				RuntimePath:                  "/usr/local/bin/containerd-shim-kata-qemu-nvidia-gpu-v2",
+				PodAnnotations:               []string{"io.katacontainers.config.hypervisor.*"},
+				ContainerAnnotations:         []string{"io.katacontainers.*", "io.kubernetes.cri-o.Devices"},
+				PrivilegedWithoutHostDevices: ptr.To(false),
+				MonitorCgroup:                "pod",
+				SetAsDefault:                 true,
+			},
+			expectedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{
+						"default_runtime": runtimeName,
+						"runtimes": map[string]interface{}{
+							runtimeName: map[string]interface{}{
+								"allowed_annotations": []string{
+									"io.katacontainers.config.hypervisor.",
+									"io.katacontainers.",
+									"io.kubernetes.cri-o.Devices",
+								},
+								"monitor_cgroup":                  "pod",
+								"privileged_without_host_devices": false,
+								"runtime_config_path":             kataConfigPath,
+								"runtime_path":                    "/usr/local/bin/containerd-shim-kata-qemu-nvidia-gpu-v2",
+								"runtime_root":                    "/run/vc",
+								"runtime_type":                    "vm",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "maps cri-o runtime types and ignores unsupported options",
+			mergedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{},
+				},
+			},
+			options: runtime.RuntimeClassOptions{
+				RuntimeType:   "pod",
+				Snapshotter:   "nydus",
+				SandboxMode:   "shim",
+				SystemdCgroup: ptr.To(true),
+			},
+			expectedConfig: map[string]interface{}{
+				"crio": map[string]interface{}{
+					"runtime": map[string]interface{}{
+						"runtimes": map[string]interface{}{
+							runtimeName: map[string]interface{}{
+								"allowed_annotations":             []string{"io.katacontainers."},
+								"privileged_without_host_devices": true,
+								"runtime_config_path":             kataConfigPath,
+								"runtime_path":                    "/opt/kata/bin/containerd-shim-kata-v2",
+								"runtime_root":                    "/run/vc",
+								"runtime_type":                    "pod",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			merged, err := toml.TreeFromMap(tc.mergedConfig)
+			require.NoError(t, err)
+			config, err := toml.TreeFromMap(map[string]interface{}{})
+			require.NoError(t, err)
+
+			c := &Config{
+				Tree:           config,
+				Merged:         merged,
+				RuntimeType:    "vm",
+				PodAnnotations: []string{"io.katacontainers.*"},
+			}
+			require.NoError(t, c.AddRuntime(runtimeName, kataConfigPath, tc.options))
+
+			expected, err := toml.TreeFromMap(tc.expectedConfig)
+			require.NoError(t, err)
+			require.Equal(t, expected.String(), config.String())
+		})
+	}
+}
+
+func TestUnsupportedOptions(t *testing.T) {
+	testCases := []struct {
+		description string
+		options     runtime.RuntimeClassOptions
+		expected    []string
+	}{
+		{
+			description: "supported options",
+			options: runtime.RuntimeClassOptions{
+				RuntimeType:   "vm",
+				RuntimePath:   "/opt/kata/bin/containerd-shim-kata-v2",
+				MonitorCgroup: "pod",
+			},
+		},
+		{
+			description: "containerd options",
+			options: runtime.RuntimeClassOptions{
+				RuntimeType:    "io.containerd.kata.v2",
+				Snapshotter:    "nydus",
+				SandboxMode:    "podsandbox",
+				SystemdCgroup:  ptr.To(true),
+				CgroupWritable: ptr.To(false),
+			},
+			expected: []string{
+				`runtime type "io.containerd.kata.v2"`,
+				`snapshotter "nydus"`,
+				`sandbox mode "podsandbox"`,
+				"systemdCgroup=true",
+				"cgroup writable=false",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			require.Equal(t, tc.expected, unsupportedOptions(tc.options))
+		})
+	}
+}
+
+func TestConfig_DropIn(t *testing.T) {
+	const (
+		runtimeName    = "kata-qemu-nvidia-gpu"
+		kataConfigPath = "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu/configuration-kata-qemu-nvidia-gpu.toml"
+	)
+
+	merged, err := toml.Load(mergedConfig)
+	require.NoError(t, err)
+	dropIn, err := toml.TreeFromMap(map[string]interface{}{})
+	require.NoError(t, err)
+
+	dropInPath := filepath.Join(t.TempDir(), "crio.conf.d", "99-nvidia-kata.conf")
+	c := &Config{
+		Tree:   dropIn,
+		Merged: merged,
+		Path:   dropInPath,
+	}
+
+	require.NoError(t, c.AddRuntime(runtimeName, kataConfigPath, runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	// Only the kata runtime is written to the drop-in file
+	output, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	written, err := toml.LoadBytes(output)
+	require.NoError(t, err)
+	require.Equal(t, []string{"crio"}, written.Keys())
+	require.Equal(t, []string{"runtimes"}, written.GetPath([]string{"crio", "runtime"}).(*toml.Tree).Keys())
+	require.Equal(t, []string{runtimeName}, written.GetPath([]string{"crio", "runtime", "runtimes"}).(*toml.Tree).Keys())
+	require.Equal(t, "12MiB", written.GetPath([]string{"crio", "runtime", "runtimes", runtimeName, "container_min_memory"}))
+	require.Nil(t, written.GetPath([]string{"crio", "runtime", "runtimes", runtimeName, "monitor_path"}))
+	require.Equal(t, "crun", c.DefaultRuntime())
+
+	require.NoError(t, c.RemoveRuntime(runtimeName))
+	n, err := c.Save()
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.NoFileExists(t, dropInPath)
+
+	// Removing a runtime which is not configured is a no-op
+	require.NoError(t, c.RemoveRuntime(runtimeName))
+}
+
+func TestConfig_SkipUnchanged(t *testing.T) {
+	const runtimeName = "kata"
+
+	merged, err := toml.Load(mergedConfig)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	dropInPath := filepath.Join(dir, "crio.conf.d", "99-nvidia-kata.conf")
+	restarter := &countingRestarter{}
+	newConfig := func() *Config {
+		dropIn, err := loadConfig(dropInPath)
+		require.NoError(t, err)
+		dropIn.Merged = merged
+		dropIn.Path = dropInPath
+		dropIn.BackupDir = filepath.Join(dir, "backups")
+		dropIn.Restarter = restarter
+		return dropIn
+	}
+
+	c := newConfig()
+	require.NoError(t, c.AddRuntime(runtimeName, "/opt/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.NoError(t, c.Restart(context.Background()))
+	require.Equal(t, 1, restarter.calls)
+
+	// Reformatting the drop-in file does not change its settings
+	output, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	reformatted := append([]byte("# edited by hand\n"), output...)
+	require.NoError(t, os.WriteFile(dropInPath, reformatted, 0600))
+
+	c = newConfig()
+	require.NoError(t, c.AddRuntime(runtimeName, "/opt/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.NoError(t, c.Restart(context.Background()))
+	require.Equal(t, 1, restarter.calls)
+
+	output, err = os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	require.Equal(t, string(reformatted), string(output))
+
+	// A restored config is always picked up by crio
+	require.NoError(t, c.Rollback())
+	require.NoError(t, c.Restart(context.Background()))
+	require.Equal(t, 2, restarter.calls)
+}
+
+func TestConfig_RemoveRuntimeRestoresPreExisting(t *testing.T) {
+	const original = `[crio.runtime.runtimes.kata]
+  runtime_path = "/usr/bin/kata-runtime"
+  runtime_type = "vm"
+  privileged_without_host_devices = false
+`
+	merged, err := toml.Load(mergedConfig)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	dropInPath := filepath.Join(dir, "crio.conf.d", "99-nvidia-kata.conf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dropInPath), 0755))
+	require.NoError(t, os.WriteFile(dropInPath, []byte(original), 0600))
+
+	newConfig := func() *Config {
+		c, err := loadConfig(dropInPath)
+		require.NoError(t, err)
+		c.Merged = merged
+		c.Path = dropInPath
+		c.owned, err = ownership.Load(filepath.Join(dir, "backups"), dropInPath)
+		require.NoError(t, err)
+		return c
+	}
+
+	c := newConfig()
+	require.NoError(t, c.AddRuntime("kata", "/opt/nvidia/kata/configuration.toml", runtime.RuntimeClassOptions{SetAsDefault: true}))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	c = newConfig()
+	require.Equal(t, "kata", c.DefaultRuntime())
+	require.NoError(t, c.RemoveRuntime("kata"))
+	_, err = c.Save()
+	require.NoError(t, err)
+
+	output, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	equal, err := runtime.Equivalent([]byte(original), output)
+	require.NoError(t, err)
+	require.True(t, equal, "unexpected config:\n%s", output)
+}
+
+func TestConfig_RollbackRestoresPreviousSave(t *testing.T) {
+	merged, err := toml.Load(mergedConfig)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	dropInPath := filepath.Join(dir, "crio.conf.d", "99-nvidia-kata.conf")
+
+	newConfig := func() *Config {
+		c, err := loadConfig(dropInPath)
+		require.NoError(t, err)
+		c.Merged = merged
+		c.Path = dropInPath
+		c.BackupDir = backupDir
+		c.owned, err = ownership.Load(backupDir, dropInPath)
+		require.NoError(t, err)
+		return c
+	}
+
+	c := newConfig()
+	require.NoError(t, c.AddRuntime("kata", "/opt/nvidia/kata/configuration.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	installed, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+
+	// A failed reconcile only reverts its own changes
+	c = newConfig()
+	require.NoError(t, c.AddRuntime("kata-snp", "/opt/nvidia/kata/configuration-snp.toml", runtime.RuntimeClassOptions{}))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.NoError(t, c.Rollback())
+
+	output, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	require.Equal(t, string(installed), string(output))
+
+	// The ownership records of the previous save are restored as well, so that
+	// removing the runtime removes the drop-in file again
+	c = newConfig()
+	require.NoError(t, c.RemoveRuntime("kata"))
+	_, err = c.Save()
+	require.NoError(t, err)
+	require.NoFileExists(t, dropInPath)
+}
+
+type countingRestarter struct {
+	calls int
+}
+
+func (r *countingRestarter) Restart(context.Context) error {
+	r.calls++
+	return nil
+}
+
+func TestNewQueriesHost(t *testing.T) {
+	executor := &fake.Executor{
+		Outputs: map[string]string{"crio-status-config": mergedConfig},
+	}
+	c, err := New(
+		WithPath(filepath.Join(t.TempDir(), "99-nvidia-kata.conf")),
+		WithHostExecutor(executor),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"crio-status-config"}, executor.Calls)
+	require.Equal(t, "crun", c.DefaultRuntime())
+
+	executor = &fake.Executor{
+		Errors: map[string]error{"crio-status-config": fmt.Errorf("crio: command not found")},
+	}
+	_, err = New(
+		WithPath(filepath.Join(t.TempDir(), "99-nvidia-kata.conf")),
+		WithHostExecutor(executor),
+	)
+	require.ErrorContains(t, err, "error getting crio config: crio: command not found")
+}
@@ -17,15 +17,36 @@
 package crio
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"os"
 
 	"github.com/pelletier/go-toml"
 	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/ownership"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
 )
 
+// runtimeTypes are the runtime types supported by CRI-O
+var runtimeTypes = []string{"oci", "vm", "pod"}
+
+// vmRuntimeOptions are the options of the runtime inherited by kata runtimes which
+// also apply to runtimes of type vm; the options of conmon and the OCI runtime
+// don't.
+var vmRuntimeOptions = []string{"container_min_memory", "default_annotations", "exec_cpu_affinity", "stream_websockets"}
+
 const (
-	defaultRuntimeType = "oci"
+	defaultRuntimeType = "vm"
+
+	// defaultKataShimPath is the kata shim binary used for runtimes of type vm
+	defaultKataShimPath = "/opt/kata/bin/containerd-shim-kata-v2"
+	// defaultKataRuntimeRoot is the root directory used by the kata shim
+	defaultKataRuntimeRoot = "/run/vc"
+
+	defaultSocket = "/var/run/crio/crio.sock"
+	defaultUnit   = "crio.service"
 )
 
 type builder struct {
@@ -33,6 +54,11 @@ type builder struct {
 	runtimeType     string
 	useLegacyConfig bool
 	podAnnotations  []string
+	backupDir       string
+	socket          string
+	restarter       restart.Strategy
+	hostRoot        host.Root
+	executor        host.Executor
 }
 
 // Option defines a function that can be used to configure the config builder
@@ -66,6 +92,43 @@ func WithPodAnnotations(podAnnotations ...string) Option {
 	}
 }
 
+// WithBackupDir sets the directory in which the original drop-in file is backed up
+func WithBackupDir(backupDir string) Option {
+	return func(b *builder) {
+		b.backupDir = backupDir
+	}
+}
+
+// WithSocket sets the socket for the config builder
+func WithSocket(socket string) Option {
+	return func(b *builder) {
+		b.socket = socket
+	}
+}
+
+// WithRestarter sets the restart strategy for the config builder
+func WithRestarter(restarter restart.Strategy) Option {
+	return func(b *builder) {
+		b.restarter = restarter
+	}
+}
+
+// WithHostRoot sets the path the host root filesystem is mounted at. The config
+// path is a local path below it, and crio is queried for its config on the host.
+func WithHostRoot(hostRoot string) Option {
+	return func(b *builder) {
+		b.hostRoot = host.Root(hostRoot)
+	}
+}
+
+// WithHostExecutor sets the executor running operations on the host. A host
+// executor for the host root is used by default.
+func WithHostExecutor(executor host.Executor) Option {
+	return func(b *builder) {
+		b.executor = executor
+	}
+}
+
 func (b *builder) build() (*Config, error) {
 	if b.path == "" {
 		return &Config{}, fmt.Errorf("config path is empty")
@@ -74,35 +137,57 @@ func (b *builder) build() (*Config, error) {
 	if b.runtimeType == "" {
 		b.runtimeType = defaultRuntimeType
 	}
+	if b.socket == "" {
+		b.socket = defaultSocket
+	}
+	if b.executor == nil {
+		b.executor = host.NewExecutor(b.hostRoot)
+	}
+
+	merged, err := loadMergedConfig(b.executor)
+	if err != nil {
+		return &Config{}, fmt.Errorf("failed to load config: %w", err)
+	}
 
 	config, err := loadConfig(b.path)
 	if err != nil {
 		return &Config{}, fmt.Errorf("failed to load config: %w", err)
 	}
+	config.Merged = merged
 	config.RuntimeType = b.runtimeType
 	config.UseDefaultRuntimeName = !b.useLegacyConfig
 	config.PodAnnotations = b.podAnnotations
 	config.Path = b.path
+	config.BackupDir = b.backupDir
+	config.Socket = b.socket
+	config.Restarter = b.restarter
+	config.HostRoot = b.hostRoot
+	config.Executor = b.executor
+
+	config.owned, err = ownership.Load(b.backupDir, b.hostRoot.HostPath(b.path))
+	if err != nil {
+		return &Config{}, err
+	}
 
 	return config, nil
 }
 
-// loadConfig loads the crio config from disk
+// loadConfig loads the kata drop-in config from disk
 func loadConfig(config string) (*Config, error) {
 	klog.Infof("Loading config: %v", config)
 
-	var args []string
-	args = append(args, "chroot", "/host", "crio", "status", "config")
-
-	klog.Infof("Getting crio config")
+	info, err := os.Stat(config)
+	if err == nil && info.IsDir() {
+		return nil, fmt.Errorf("config file is a directory")
+	}
 
-	// TODO: Can we harden this so that there is less risk of command injection
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("error getting crio config: %w", err)
+	configFile := config
+	if os.IsNotExist(err) {
+		configFile = "/dev/null"
+		klog.Infof("Config file does not exist, creating new one")
 	}
-	tomlConfig, err := toml.LoadBytes(output)
+
+	tomlConfig, err := toml.LoadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
@@ -114,3 +199,15 @@ func loadConfig(config string) (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// loadMergedConfig loads the crio config resulting from merging the main config
+// file, all drop-in files and the built-in defaults, as reported by crio on the host
+func loadMergedConfig(executor host.Executor) (*toml.Tree, error) {
+	klog.Infof("Getting crio config")
+
+	output, err := executor.Run(context.Background(), host.CrioStatusConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error getting crio config: %w", err)
+	}
+	return toml.LoadBytes(output)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+)
+
+// hostProbe lists the sockets and config files indicating a container runtime on the
+// host. Only the default paths are probed, as those are the paths the runtime
+// config is written to unless set explicitly.
+type hostProbe struct {
+	runtime api.Runtime
+	sockets []string
+	configs []string
+}
+
+var hostProbes = []hostProbe{
+	{
+		runtime: api.Containerd,
+		sockets: []string{"/run/containerd/containerd.sock"},
+		configs: []string{"/etc/containerd/config.toml"},
+	},
+	{
+		runtime: api.CRIO,
+		sockets: []string{"/run/crio/crio.sock", "/var/run/crio/crio.sock"},
+		configs: []string{"/etc/crio/crio.conf", "/etc/crio/crio.conf.d"},
+	},
+}
+
+// Parse returns the container runtime with the specified name
+func Parse(name string) (api.Runtime, error) {
+	switch r := api.Runtime(name); r {
+	case api.Containerd, api.CRIO:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unsupported container runtime %q, must be one of %q or %q", name, api.Containerd, api.CRIO)
+	}
+}
+
+// Detect returns the container runtime of the node. The runtime reported in the
+// containerRuntimeVersion of the node status (e.g. containerd://1.7.2) takes
+// precedence; if it is empty, the runtime is detected from the sockets and config
+// files found under the host root.
+func Detect(nodeRuntimeVersion string, hostRoot string) (api.Runtime, error) {
+	if nodeRuntimeVersion != "" {
+		return fromRuntimeVersion(nodeRuntimeVersion)
+	}
+
+	if r, err := detectFromHost(hostRoot, func(p hostProbe) []string { return p.sockets }, isSocket); r != "" || err != nil {
+		return r, err
+	}
+	if r, err := detectFromHost(hostRoot, func(p hostProbe) []string { return p.configs }, exists); r != "" || err != nil {
+		return r, err
+	}
+	return "", fmt.Errorf("unable to detect the container runtime: no runtime socket or config found under %v", hostRoot)
+}
+
+// fromRuntimeVersion returns the runtime of a containerRuntimeVersion reported by the kubelet
+func fromRuntimeVersion(version string) (api.Runtime, error) {
+	name, _, _ := strings.Cut(version, "://")
+	switch name {
+	case "containerd":
+		return api.Containerd, nil
+	case "cri-o":
+		return api.CRIO, nil
+	default:
+		return "", fmt.Errorf("unsupported container runtime %q reported by the node", version)
+	}
+}
+
+// detectFromHost returns the only runtime for which one of the probed paths exists
+func detectFromHost(hostRoot string, paths func(hostProbe) []string, found func(string) bool) (api.Runtime, error) {
+	var detected []api.Runtime
+	for _, p := range hostProbes {
+		for _, path := range paths(p) {
+			if found(filepath.Join(hostRoot, path)) {
+				klog.Infof("Found %v for container runtime %v", path, p.runtime)
+				detected = append(detected, p.runtime)
+				break
+			}
+		}
+	}
+
+	switch len(detected) {
+	case 0:
+		return "", nil
+	case 1:
+		return detected[0], nil
+	default:
+		return "", fmt.Errorf("unable to detect the container runtime: found %q on the host, use --runtime to select one", detected)
+	}
+}
+
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		description        string
+		nodeRuntimeVersion string
+		sockets            []string
+		files              []string
+		expectedRuntime    api.Runtime
+		expectedError      bool
+	}{
+		{
+			description:        "containerd reported by node",
+			nodeRuntimeVersion: "containerd://1.7.2",
+			files:              []string{"/etc/crio/crio.conf"},
+			expectedRuntime:    api.Containerd,
+		},
+		{
+			description:        "cri-o reported by node",
+			nodeRuntimeVersion: "cri-o://1.28.1",
+			expectedRuntime:    api.CRIO,
+		},
+		{
+			description:        "unsupported runtime reported by node",
+			nodeRuntimeVersion: "docker://24.0.5",
+			expectedError:      true,
+		},
+		{
+			description:     "containerd socket",
+			sockets:         []string{"/run/containerd/containerd.sock"},
+			files:           []string{"/etc/crio/crio.conf"},
+			expectedRuntime: api.Containerd,
+		},
+		{
+			description:     "crio config",
+			files:           []string{"/etc/crio/crio.conf.d/10-crun.conf"},
+			expectedRuntime: api.CRIO,
+		},
+		{
+			description:   "both runtimes running",
+			sockets:       []string{"/run/containerd/containerd.sock", "/run/crio/crio.sock"},
+			expectedError: true,
+		},
+		{
+			description:   "no runtime",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			hostRoot := t.TempDir()
+			for _, f := range tc.files {
+				path := filepath.Join(hostRoot, f)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, nil, 0644))
+			}
+			for _, s := range tc.sockets {
+				path := filepath.Join(hostRoot, s)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				l, err := net.Listen("unix", path)
+				require.NoError(t, err)
+				t.Cleanup(func() { l.Close() })
+			}
+
+			r, err := Detect(tc.nodeRuntimeVersion, hostRoot)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedRuntime, r)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("crio")
+	require.NoError(t, err)
+	require.Equal(t, api.CRIO, r)
+
+	_, err = Parse("docker")
+	require.Error(t, err)
+}
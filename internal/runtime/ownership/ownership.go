@@ -0,0 +1,198 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ownership
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pelletier/go-toml"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/backup"
+)
+
+// Records holds the keys of a config file which were created or changed by kata
+// manager, together with the values they had before, so that cleanup restores
+// exactly the previous state of the config.
+type Records struct {
+	// path is the state file the records are persisted to; the records are only
+	// kept in memory if it is empty
+	path    string
+	Entries []Record `json:"entries"`
+}
+
+// Record holds the previous value of a key
+type Record struct {
+	Key []string `json:"key"`
+	// Previous is the previous value of the key encoded as TOML, or nil if the key
+	// did not exist
+	Previous *string `json:"previous,omitempty"`
+}
+
+// Load loads the records of the config file at configPath from the state directory.
+// The records are only kept in memory if dir is empty.
+func Load(dir string, configPath string) (*Records, error) {
+	r := &Records{}
+	if dir == "" {
+		return r, nil
+	}
+	r.path = filepath.Join(dir, backup.Name(configPath)+".owned")
+
+	content, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ownership records: %w", err)
+	}
+	if err := json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("unable to parse ownership records %v: %w", r.path, err)
+	}
+	return r, nil
+}
+
+// Path returns the state file the records are persisted to, or an empty string if
+// they are only kept in memory
+func (r *Records) Path() string {
+	if r == nil {
+		return ""
+	}
+	return r.path
+}
+
+// Track records the current value of the key in the config before it is created or
+// changed. Keys which are already tracked keep their original value.
+func (r *Records) Track(config *toml.Tree, key ...string) error {
+	if r == nil || r.find(key) >= 0 {
+		return nil
+	}
+
+	record := Record{Key: slices.Clone(key)}
+	if value := config.GetPath(key); value != nil {
+		encoded, err := encode(value)
+		if err != nil {
+			return fmt.Errorf("unable to record previous value of %v: %w", key, err)
+		}
+		record.Previous = &encoded
+	}
+	r.Entries = append(r.Entries, record)
+	return nil
+}
+
+// Tracked returns whether the key is tracked
+func (r *Records) Tracked(key ...string) bool {
+	return r != nil && r.find(key) >= 0
+}
+
+// Restore restores the previous value of a tracked key in the config, removing the
+// key if it did not exist before, and stops tracking it. It returns false if the
+// key is not tracked, leaving the config untouched.
+func (r *Records) Restore(config *toml.Tree, key ...string) (bool, error) {
+	if r == nil {
+		return false, nil
+	}
+	i := r.find(key)
+	if i < 0 {
+		return false, nil
+	}
+
+	record := r.Entries[i]
+	if record.Previous == nil {
+		if config.HasPath(key) {
+			if err := config.DeletePath(key); err != nil {
+				return false, err
+			}
+		}
+	} else {
+		value, err := decode(*record.Previous)
+		if err != nil {
+			return false, fmt.Errorf("unable to restore previous value of %v: %w", key, err)
+		}
+		config.SetPath(key, value)
+	}
+
+	r.Entries = slices.Delete(r.Entries, i, i+1)
+	return true, nil
+}
+
+// Save persists the records, removing the state file once no key is tracked
+func (r *Records) Save() error {
+	if r == nil || r.path == "" {
+		return nil
+	}
+	if len(r.Entries) == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove ownership records: %w", err)
+		}
+		return nil
+	}
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, content, 0600); err != nil {
+		return fmt.Errorf("unable to write ownership records: %w", err)
+	}
+	return nil
+}
+
+// Discard stops tracking all keys, e.g. after the config file has been restored
+// from its backup
+func (r *Records) Discard() error {
+	if r == nil {
+		return nil
+	}
+	r.Entries = nil
+	return r.Save()
+}
+
+func (r *Records) find(key []string) int {
+	return slices.IndexFunc(r.Entries, func(e Record) bool {
+		return slices.Equal(e.Key, key)
+	})
+}
+
+// encode encodes a value as TOML by wrapping it in a document under the key value
+func encode(value interface{}) (string, error) {
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return "", err
+	}
+	if t, ok := value.(*toml.Tree); ok {
+		// Copy the table so that later changes to the config are not recorded
+		if value, err = toml.Load(t.String()); err != nil {
+			return "", err
+		}
+	}
+	tree.Set("value", value)
+	return tree.ToTomlString()
+}
+
+func decode(encoded string) (interface{}, error) {
+	tree, err := toml.Load(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Get("value"), nil
+}
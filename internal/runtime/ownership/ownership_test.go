@@ -0,0 +1,88 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ownership
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecords(t *testing.T) {
+	const original = `[runtimes]
+  default = "runc"
+
+  [runtimes.kata]
+    runtime_type = "io.containerd.kata.v2"
+    pod_annotations = ["io.katacontainers.*"]
+`
+	dir := t.TempDir()
+	config, err := toml.Load(original)
+	require.NoError(t, err)
+
+	r, err := Load(dir, "/etc/containerd/config.toml")
+	require.NoError(t, err)
+	require.NoError(t, r.Track(config, "runtimes", "kata"))
+	require.NoError(t, r.Track(config, "runtimes", "default"))
+	require.NoError(t, r.Track(config, "runtimes", "kata-snp"))
+
+	config.SetPath([]string{"runtimes", "kata", "runtime_type"}, "io.containerd.kata-qemu.v2")
+	config.SetPath([]string{"runtimes", "default"}, "kata")
+	config.SetPath([]string{"runtimes", "kata-snp", "runtime_type"}, "io.containerd.kata-snp.v2")
+
+	// Tracking a key again keeps its original value
+	require.NoError(t, r.Track(config, "runtimes", "kata"))
+	require.NoError(t, r.Save())
+
+	// The records survive a restart of kata manager
+	r, err = Load(dir, "/etc/containerd/config.toml")
+	require.NoError(t, err)
+	require.True(t, r.Tracked("runtimes", "kata"))
+
+	for _, key := range [][]string{{"runtimes", "kata"}, {"runtimes", "default"}, {"runtimes", "kata-snp"}} {
+		restored, err := r.Restore(config, key...)
+		require.NoError(t, err)
+		require.True(t, restored)
+	}
+	restored, err := r.Restore(config, "runtimes", "runc")
+	require.NoError(t, err)
+	require.False(t, restored)
+
+	expected, err := toml.Load(original)
+	require.NoError(t, err)
+	require.Equal(t, expected.ToMap(), config.ToMap())
+
+	require.NoError(t, r.Save())
+	require.NoFileExists(t, r.path)
+}
+
+func TestRecordsInMemory(t *testing.T) {
+	config, err := toml.Load(`default = "runc"`)
+	require.NoError(t, err)
+
+	r, err := Load("", "/etc/crio/crio.conf.d/99-nvidia-kata.conf")
+	require.NoError(t, err)
+	require.NoError(t, r.Track(config, "default"))
+	require.NoError(t, r.Save())
+
+	config.Set("default", "kata")
+	restored, err := r.Restore(config, "default")
+	require.NoError(t, err)
+	require.True(t, restored)
+	require.Equal(t, "runc", config.Get("default"))
+}
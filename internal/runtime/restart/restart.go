@@ -0,0 +1,210 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+)
+
+// Names of the restart strategies
+const (
+	// Signal sends a SIGHUP to the process serving the runtime socket, which makes
+	// containerd exit so that its service manager restarts it
+	Signal = "signal"
+	// SystemdRestart restarts the systemd unit of the runtime through D-Bus
+	SystemdRestart = "systemd-restart"
+	// SystemdReload reloads the systemd unit of the runtime through D-Bus
+	SystemdReload = "systemd-reload"
+	// Command runs a custom command on the host
+	Command = "command"
+	// None leaves restarting the runtime to the operator
+	None = "none"
+)
+
+const defaultTimeout = 2 * time.Minute
+
+// Strategy restarts a container runtime so that it picks up config changes
+type Strategy interface {
+	// Restart restarts or reloads the runtime and waits for its socket to become
+	// healthy again
+	Restart(ctx context.Context) error
+}
+
+// Options configures a restart strategy
+type Options struct {
+	// Strategy is the name of the strategy
+	Strategy string
+	// Socket is the CRI socket of the runtime
+	Socket string
+	// Unit is the systemd unit of the runtime
+	Unit string
+	// Command is the shell command run on the host
+	Command string
+	// HostRoot is the path the host root filesystem is mounted at
+	HostRoot string
+	// Executor runs the systemd calls and commands on the host; a host executor for
+	// HostRoot is used if it is nil
+	Executor host.Executor
+	// Timeout bounds the time waited for the runtime socket to become healthy
+	Timeout time.Duration
+}
+
+type strategy struct {
+	name    string
+	socket  string
+	timeout time.Duration
+	// replacesProcess is set if the strategy starts a new runtime process
+	replacesProcess bool
+	restart         func(ctx context.Context) error
+}
+
+// New creates the restart strategy described by the options
+func New(o Options) (Strategy, error) {
+	s := &strategy{
+		name:    o.Strategy,
+		socket:  o.Socket,
+		timeout: o.Timeout,
+	}
+	if s.timeout == 0 {
+		s.timeout = defaultTimeout
+	}
+	executor := o.Executor
+	if executor == nil {
+		executor = host.NewExecutor(host.Root(o.HostRoot))
+	}
+
+	switch o.Strategy {
+	case Signal:
+		s.replacesProcess = true
+		s.restart = func(ctx context.Context) error {
+			return SignalRestart(ctx, o.Socket)
+		}
+	case SystemdRestart, SystemdReload:
+		if o.Unit == "" {
+			return nil, fmt.Errorf("no systemd unit specified for the %s restart strategy", o.Strategy)
+		}
+		op := host.SystemdRestartUnit
+		if o.Strategy == SystemdReload {
+			op = host.SystemdReloadUnit
+		}
+		if err := host.Validate(op, o.Unit); err != nil {
+			return nil, fmt.Errorf("invalid systemd unit for the %s restart strategy: %w", o.Strategy, err)
+		}
+		s.replacesProcess = o.Strategy == SystemdRestart
+		s.restart = func(ctx context.Context) error {
+			_, err := executor.Run(ctx, op, o.Unit)
+			return err
+		}
+	case Command:
+		if o.Command == "" {
+			return nil, fmt.Errorf("no command specified for the %s restart strategy", o.Strategy)
+		}
+		s.restart = func(ctx context.Context) error {
+			klog.Infof("Running restart command on the host: %s", o.Command)
+			output, err := executor.Run(ctx, host.Shell, o.Command)
+			if len(output) > 0 {
+				klog.Infof("Restart command output: %s", strings.TrimSpace(string(output)))
+			}
+			return err
+		}
+	case None:
+		s.restart = func(context.Context) error {
+			klog.Infof("Not restarting the runtime, it is expected to be restarted out of band")
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported restart strategy %q", o.Strategy)
+	}
+	return s, nil
+}
+
+// Restart restarts the runtime and waits for its socket to become healthy
+func (s *strategy) Restart(ctx context.Context) error {
+	var pid int
+	if s.replacesProcess {
+		var err error
+		if pid, err = socketPID(s.socket); err != nil {
+			klog.Warningf("Unable to determine the runtime process: %v", err)
+		}
+	}
+
+	klog.Infof("Restarting runtime using the %s strategy", s.name)
+	if err := s.restart(ctx); err != nil {
+		return fmt.Errorf("%s restart failed: %w", s.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return waitHealthy(ctx, s.socket, pid)
+}
+
+// waitHealthy waits until the runtime serving the socket reports that it is ready.
+// If previousPID is set, the socket has to be served by a new process.
+func waitHealthy(ctx context.Context, socket string, previousPID int) error {
+	client, err := cri.NewClient(socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		lastErr = checkHealthy(ctx, client, socket, previousPID)
+		if lastErr == nil {
+			klog.Infof("Runtime socket %v is healthy", socket)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("runtime socket %v did not become healthy: %w: %w", socket, ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkHealthy(ctx context.Context, client *cri.Client, socket string, previousPID int) error {
+	if previousPID != 0 {
+		pid, err := socketPID(socket)
+		if err != nil {
+			return err
+		}
+		if pid == previousPID {
+			return fmt.Errorf("runtime process %d has not been restarted yet", pid)
+		}
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if !status.Ready() {
+		return fmt.Errorf("runtime is not ready")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri/fake"
+	hostfake "github.com/NVIDIA/k8s-kata-manager/internal/host/fake"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		description   string
+		options       Options
+		expectedError bool
+	}{
+		{
+			description: "signal",
+			options:     Options{Strategy: Signal, Socket: "/run/containerd/containerd.sock"},
+		},
+		{
+			description:   "systemd without unit",
+			options:       Options{Strategy: SystemdRestart},
+			expectedError: true,
+		},
+		{
+			description:   "systemd with invalid unit",
+			options:       Options{Strategy: SystemdRestart, Unit: "crio.service; reboot"},
+			expectedError: true,
+		},
+		{
+			description:   "command without command",
+			options:       Options{Strategy: Command},
+			expectedError: true,
+		},
+		{
+			description:   "unknown strategy",
+			options:       Options{Strategy: "reboot"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := New(tc.options)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRestartWaitsForHealthySocket(t *testing.T) {
+	executor := &hostfake.Executor{}
+	runtime := &fake.Runtime{}
+	socket := filepath.Join(t.TempDir(), "crio.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	s, err := New(Options{
+		Strategy: SystemdReload,
+		Socket:   socket,
+		Unit:     "crio.service",
+		Executor: executor,
+		Timeout:  5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		runtime.SetReady(true)
+	}()
+	require.NoError(t, s.Restart(context.Background()))
+	require.Equal(t, []string{"systemd-reload-unit crio.service"}, executor.Calls)
+}
+
+func TestRestartCommand(t *testing.T) {
+	runtime := &fake.Runtime{Ready: true}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	executor := &hostfake.Executor{
+		Errors: map[string]error{"shell systemctl restart containerd": fmt.Errorf("exit status 1")},
+	}
+	s, err := New(Options{
+		Strategy: Command,
+		Socket:   socket,
+		Command:  "systemctl restart containerd",
+		Executor: executor,
+		Timeout:  5 * time.Second,
+	})
+	require.NoError(t, err)
+	require.ErrorContains(t, s.Restart(context.Background()), "command restart failed: exit status 1")
+	require.Equal(t, []string{"shell systemctl restart containerd"}, executor.Calls)
+}
+
+func TestRestartTimesOut(t *testing.T) {
+	runtime := &fake.Runtime{}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	s, err := New(Options{Strategy: None, Socket: socket, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.ErrorContains(t, s.Restart(context.Background()), "not ready")
+}
+
+func TestRestartCanceled(t *testing.T) {
+	runtime := &fake.Runtime{}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	s, err := New(Options{Strategy: None, Socket: socket, Timeout: time.Minute})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err = s.Restart(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
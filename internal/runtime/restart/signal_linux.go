@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const (
+	reloadBackoff     = 5 * time.Second
+	maxReloadAttempts = 6
+)
+
+// SignalRestart sends a SIGHUP signal to the process serving the runtime socket.
+// containerd does not reload its config on SIGHUP, it exits and relies on its
+// service manager (e.g. systemd with Restart=always) to start it again.
+func SignalRestart(ctx context.Context, socket string) error {
+	err := signalRuntime(ctx, socket, syscall.SIGHUP)
+	if err != nil {
+		return fmt.Errorf("unable to signal runtime: %w", err)
+	}
+
+	return nil
+}
+
+// signalRuntime sends a signal to the process serving the runtime socket
+func signalRuntime(ctx context.Context, socket string, sig syscall.Signal) error {
+	klog.Infof("Sending %v signal to the runtime serving %v", sig, socket)
+
+	// Wrap the logic to send the signal in a function, so we can retry it on failure
+	retriable := func() error {
+		pid, err := socketPID(socket)
+		if err != nil {
+			return err
+		}
+
+		err = syscall.Kill(pid, sig)
+		if err != nil {
+			return fmt.Errorf("unable to send %v to runtime process %d: %w", sig, pid, err)
+		}
+
+		return nil
+	}
+
+	// Try to send the signal up to maxReloadAttempts times
+	var err error
+	for i := 0; i < maxReloadAttempts; i++ {
+		err = retriable()
+		if err == nil {
+			break
+		}
+		if i == maxReloadAttempts-1 {
+			break
+		}
+		klog.Warningf("Error signaling runtime, attempt %v/%v: %v", i+1, maxReloadAttempts, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(reloadBackoff):
+		}
+	}
+	if err != nil {
+		klog.Warningf("Max retries reached %v/%v, aborting", maxReloadAttempts, maxReloadAttempts)
+		return err
+	}
+
+	klog.Infof("Successfully signaled runtime")
+	return nil
+}
+
+// socketPID returns the PID of the process serving the runtime socket
+func socketPID(socket string) (int, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return 0, fmt.Errorf("unable to dial: %w", err)
+	}
+	defer conn.Close()
+
+	sconn, err := conn.(*net.UnixConn).SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get syscall connection: %w", err)
+	}
+
+	var ucred *unix.Ucred
+	socketErr := sconn.Control(func(fd uintptr) {
+		ucred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if socketErr != nil {
+		return 0, fmt.Errorf("unable to issue call on socket fd: %w", socketErr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to get peer credentials: %w", err)
+	}
+	return int(ucred.Pid), nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cri/fake"
+)
+
+func TestSignalRestart(t *testing.T) {
+	// The fake runtime is served by the test process, which therefore receives the signal
+	runtime := &fake.Runtime{}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	pid, err := socketPID(socket)
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), pid)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	require.NoError(t, SignalRestart(context.Background(), socket))
+
+	select {
+	case sig := <-signals:
+		require.Equal(t, syscall.SIGHUP, sig)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal received")
+	}
+}
+
+func TestSignalRestartCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := SignalRestart(ctx, filepath.Join(t.TempDir(), "missing.sock"))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSignalRestartWaitsForNewProcess(t *testing.T) {
+	// The test process keeps serving the socket after the signal, as if the runtime
+	// had not been restarted by its service manager
+	runtime := &fake.Runtime{Ready: true}
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	require.NoError(t, runtime.Serve(socket))
+	defer runtime.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	s, err := New(Options{Strategy: Signal, Socket: socket, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.ErrorContains(t, s.Restart(context.Background()), "has not been restarted yet")
+}
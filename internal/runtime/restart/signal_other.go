@@ -0,0 +1,34 @@
+//go:build !linux
+
+/**
+# Copyright 2024 NVIDIA CORPORATION
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+**/
+
+package restart
+
+import (
+	"context"
+	"fmt"
+)
+
+// SignalRestart is not supported on non-linux platforms.
+func SignalRestart(context.Context, string) error {
+	return fmt.Errorf("SignalRestart is not supported on non-linux platforms")
+}
+
+// socketPID is not supported on non-linux platforms.
+func socketPID(string) (int, error) {
+	return 0, fmt.Errorf("socketPID is not supported on non-linux platforms")
+}
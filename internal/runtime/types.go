@@ -16,17 +16,134 @@
 
 package runtime
 
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	api "github.com/NVIDIA/k8s-kata-manager/api/v1alpha1/config"
+	"github.com/NVIDIA/k8s-kata-manager/internal/host"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
+)
+
 type Runtime interface {
-	AddRuntime(name string, path string, setAsDefault bool) error
+	AddRuntime(name string, path string, opts RuntimeClassOptions) error
 	DefaultRuntime() string
 	RemoveRuntime(name string) error
 	Save() (int64, error)
-	Restart() error
+	// Unchanged returns true if the last Save found the config files to already hold
+	// the updated config, in which case Restart does not restart the runtime
+	Unchanged() bool
+	// Restart restarts the runtime and returns once the runtime is ready again or the
+	// context is done
+	Restart(ctx context.Context) error
+	// Rollback restores the runtime config to its content before the last Save. The
+	// runtime has to be restarted for the restored config to apply.
+	Rollback() error
+	// Changes returns the changes Save would make to the config files, without
+	// writing them
+	Changes() ([]FileChange, error)
+}
+
+// FileChange describes the change of a config file. Old is nil if the file does not
+// exist and New is nil if the file is removed.
+type FileChange struct {
+	Path string
+	Old  []byte
+	New  []byte
+}
+
+// Changed returns true if the content or existence of the file changes
+func (f FileChange) Changed() bool {
+	return (f.Old == nil) != (f.New == nil) || !bytes.Equal(f.Old, f.New)
+}
+
+// Modified returns true if the settings or existence of the file change; changes to
+// formatting and comments only are ignored
+func (f FileChange) Modified() bool {
+	if (f.Old == nil) != (f.New == nil) {
+		return true
+	}
+	equal, err := Equivalent(f.Old, f.New)
+	return err != nil || !equal
+}
+
+// ReadFile returns the content of the file at path, or nil if it does not exist
+func ReadFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %w", path, err)
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	return content, nil
 }
 
 type Options struct {
 	PodAnnotations []string
 	Path           string
+	DropInPath     string
 	RuntimeType    string
 	Socket         string
+	// BackupDir is the directory in which original runtime configs are backed up
+	BackupDir string
+	// HostRoot is the path the host root filesystem is mounted at. The paths of the
+	// options are local paths below it; paths written to config files and backups
+	// are translated to paths on the host.
+	HostRoot string
+	// Restarter restarts the runtime; the default strategy of the runtime backend is
+	// used if it is nil
+	Restarter restart.Strategy
+	// Executor runs operations on the host; a host executor for HostRoot is used if
+	// it is nil
+	Executor host.Executor
+}
+
+// RuntimeClassOptions defines the per runtime class settings used when adding a runtime.
+// Settings left at their zero value keep the defaults of the runtime backend.
+type RuntimeClassOptions struct {
+	// RuntimeType overrides the runtime type of the runtime backend for this runtime class
+	RuntimeType string
+	// RuntimePath is the path to the runtime (shim) binary
+	RuntimePath string
+	// Snapshotter is the snapshotter used for containers of the runtime class
+	Snapshotter string
+	// PodAnnotations overrides the pod annotations of the runtime backend
+	PodAnnotations []string
+	// ContainerAnnotations is the list of container annotations passed to the runtime
+	ContainerAnnotations []string
+	// SandboxMode is the sandbox mode of the runtime
+	SandboxMode string
+	// PrivilegedWithoutHostDevices prevents host devices from being passed to privileged containers
+	PrivilegedWithoutHostDevices *bool
+	// SystemdCgroup configures the shim to use the systemd cgroup driver
+	SystemdCgroup *bool
+	// CgroupWritable makes the cgroup hierarchy writable from within the container
+	CgroupWritable *bool
+	// MonitorCgroup is the cgroup used for the container monitor process
+	MonitorCgroup string
+	// SetAsDefault configures the runtime class as the default runtime
+	SetAsDefault bool
+}
+
+// NewRuntimeClassOptions returns the runtime options configured for a runtime class
+func NewRuntimeClassOptions(rc *api.RuntimeClass) RuntimeClassOptions {
+	return RuntimeClassOptions{
+		RuntimeType:                  rc.RuntimeType,
+		RuntimePath:                  rc.Runtime.RuntimePath,
+		Snapshotter:                  rc.Runtime.Snapshotter,
+		PodAnnotations:               rc.Runtime.PodAnnotations,
+		ContainerAnnotations:         rc.Runtime.ContainerAnnotations,
+		SandboxMode:                  rc.Runtime.SandboxMode,
+		PrivilegedWithoutHostDevices: rc.Runtime.PrivilegedWithoutHostDevices,
+		SystemdCgroup:                rc.Runtime.Cgroup.SystemdCgroup,
+		CgroupWritable:               rc.Runtime.Cgroup.Writable,
+		MonitorCgroup:                rc.Runtime.Cgroup.MonitorCgroup,
+		SetAsDefault:                 rc.Runtime.Default,
+	}
 }
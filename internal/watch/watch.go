@@ -0,0 +1,202 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// Change describes the changes observed during a quiet period
+type Change struct {
+	// Paths are the changed files and directories
+	Paths []string
+	// Writers are the processes which modified files in the directories of the
+	// changed paths since the last change was reported, if they could be determined
+	Writers []string
+}
+
+// Watcher watches files and directories and reports their changes once no further
+// change happened for the debounce period. Files are watched through their parent
+// directory, so that files replaced by a rename are still tracked.
+type Watcher struct {
+	watcher  *fsnotify.Watcher
+	writers  *writerTracker
+	debounce time.Duration
+
+	// files are the watched files and dirs the watched directories; any change to
+	// an entry of a watched directory is reported as a change of the directory
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+// New creates a watcher for the files and directories. The parent directories of
+// the files and directories have to exist; watched directories are picked up once
+// they are created.
+func New(debounce time.Duration, files []string, dirs []string) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create watcher: %w", err)
+	}
+
+	w := &Watcher{
+		watcher:  fw,
+		debounce: debounce,
+		files:    make(map[string]bool),
+		dirs:     make(map[string]bool),
+	}
+
+	parents := make(map[string]bool)
+	for _, f := range files {
+		f = filepath.Clean(f)
+		w.files[f] = true
+		parents[filepath.Dir(f)] = true
+	}
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		w.dirs[d] = true
+		parents[filepath.Dir(d)] = true
+		if info, err := os.Stat(d); err == nil && info.IsDir() {
+			parents[d] = true
+		}
+	}
+	for p := range parents {
+		if err := fw.Add(p); err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("unable to watch %v: %w", p, err)
+		}
+	}
+
+	w.writers = newWriterTracker(keys(parents))
+	return w, nil
+}
+
+// Run reports changes to onChange until the context is canceled
+func (w *Watcher) Run(ctx context.Context, onChange func(Change)) {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Warningf("Error watching files: %v", err)
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			path := w.watched(event)
+			if path == "" {
+				continue
+			}
+			klog.V(4).Infof("Observed %v", event)
+			pending[path] = true
+			timer.Reset(w.debounce)
+		case <-timer.C:
+			change := Change{Paths: keys(pending)}
+			seen := make(map[string]bool)
+			for _, p := range change.Paths {
+				for _, dir := range []string{filepath.Dir(p), p} {
+					writer := w.writers.takeWriter(dir)
+					if writer != "" && !seen[writer] {
+						seen[writer] = true
+						change.Writers = append(change.Writers, writer)
+					}
+				}
+			}
+			pending = make(map[string]bool)
+			onChange(change)
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	w.writers.close()
+	return w.watcher.Close()
+}
+
+// Snapshot returns the content of the files and of the regular files in the
+// directories by path. Files which cannot be read are left out.
+func Snapshot(files []string, dirs []string) map[string]string {
+	content := make(map[string]string)
+	read := func(path string) {
+		if b, err := os.ReadFile(path); err == nil {
+			content[path] = string(b)
+		}
+	}
+	for _, f := range files {
+		read(f)
+	}
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				read(filepath.Join(d, e.Name()))
+			}
+		}
+	}
+	return content
+}
+
+// watched returns the watched file or directory affected by the event, or an empty
+// string if the event does not affect any of them
+func (w *Watcher) watched(event fsnotify.Event) string {
+	name := filepath.Clean(event.Name)
+	if w.files[name] {
+		return name
+	}
+	if w.dirs[name] {
+		// Start watching a watched directory once it has been created
+		if event.Has(fsnotify.Create) {
+			if err := w.watcher.Add(name); err != nil {
+				klog.Warningf("Unable to watch %v: %v", name, err)
+			}
+		}
+		return name
+	}
+	if dir := filepath.Dir(name); w.dirs[dir] && !strings.HasPrefix(filepath.Base(name), ".") {
+		return dir
+	}
+	return ""
+}
+
+func keys(m map[string]bool) []string {
+	var s []string
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.toml")
+	dropIns := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.WriteFile(config, []byte("version = 2\n"), 0600))
+
+	w, err := New(50*time.Millisecond, []string{config}, []string{dropIns})
+	require.NoError(t, err)
+	defer w.Close()
+
+	changes := make(chan Change, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func(c Change) { changes <- c })
+
+	next := func() Change {
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change reported")
+		}
+		return Change{}
+	}
+
+	// Changes within the debounce period are reported once
+	require.NoError(t, os.WriteFile(config, []byte("version = 3\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated.toml"), nil, 0600))
+	require.NoError(t, os.WriteFile(config, []byte("version = 2\n"), 0600))
+	require.Equal(t, []string{config}, next().Paths)
+
+	// Replacing the file through a rename is reported
+	tmp := filepath.Join(dir, ".config.toml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("version = 3\n"), 0600))
+	require.NoError(t, os.Rename(tmp, config))
+	require.Equal(t, []string{config}, next().Paths)
+
+	// Files in a drop-in directory created after the watcher are reported
+	require.NoError(t, os.Mkdir(dropIns, 0755))
+	require.Equal(t, []string{dropIns}, next().Paths)
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(dropIns, "50-toolkit.toml"), nil, 0600))
+	require.Equal(t, []string{dropIns}, next().Paths)
+
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected change %v", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.toml")
+	dropIns := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.WriteFile(config, []byte("version = 2\n"), 0600))
+	require.NoError(t, os.Mkdir(dropIns, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropIns, "99-nvidia-kata.toml"), []byte("[plugins]\n"), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(dropIns, "subdir"), 0755))
+
+	snapshot := Snapshot([]string{config, filepath.Join(dir, "missing.toml")}, []string{dropIns, filepath.Join(dir, "missing.d")})
+	require.Equal(t, map[string]string{
+		config: "version = 2\n",
+		filepath.Join(dropIns, "99-nvidia-kata.toml"): "[plugins]\n",
+	}, snapshot)
+
+	// Rewriting a file with the same content keeps the snapshot
+	require.NoError(t, os.WriteFile(config, []byte("version = 2\n"), 0600))
+	require.Equal(t, snapshot, Snapshot([]string{config}, []string{dropIns}))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dropIns, "50-toolkit.toml"), nil, 0600))
+	require.NotEqual(t, snapshot, Snapshot([]string{config}, []string{dropIns}))
+}
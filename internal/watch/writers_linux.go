@@ -0,0 +1,125 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// writerTracker records the processes modifying files in a set of directories
+// through fanotify, which, unlike inotify, reports the PID of the writer. This
+// requires CAP_SYS_ADMIN; writers are not tracked without it.
+type writerTracker struct {
+	file *os.File
+
+	mu      sync.Mutex
+	writers map[string]string
+}
+
+func newWriterTracker(dirs []string) *writerTracker {
+	t := &writerTracker{writers: make(map[string]string)}
+
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_LARGEFILE)
+	if err != nil {
+		klog.V(2).Infof("Unable to track processes modifying watched files: %v", err)
+		return t
+	}
+	for _, dir := range dirs {
+		err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD, unix.FAN_MODIFY|unix.FAN_CLOSE_WRITE|unix.FAN_EVENT_ON_CHILD, unix.AT_FDCWD, dir)
+		if err != nil {
+			klog.V(2).Infof("Unable to track processes modifying files in %v: %v", dir, err)
+		}
+	}
+
+	// A non-blocking file is handled by the runtime poller, so that closing the file
+	// stops the reader
+	t.file = os.NewFile(uintptr(fd), "fanotify")
+	go t.read()
+	return t
+}
+
+// takeWriter returns the process which last modified a file in the directory since
+// the last call, if any
+func (t *writerTracker) takeWriter(dir string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	writer := t.writers[dir]
+	delete(t.writers, dir)
+	return writer
+}
+
+func (t *writerTracker) close() {
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+func (t *writerTracker) read() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := t.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			klog.V(2).Infof("Unable to read fanotify events: %v", err)
+			return
+		}
+
+		for offset := 0; offset+int(unsafe.Sizeof(unix.FanotifyEventMetadata{})) <= n; {
+			event := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[offset]))
+			if event.Vers != unix.FANOTIFY_METADATA_VERSION || event.Event_len == 0 {
+				break
+			}
+			t.record(event)
+			offset += int(event.Event_len)
+		}
+	}
+}
+
+func (t *writerTracker) record(event *unix.FanotifyEventMetadata) {
+	if event.Fd < 0 {
+		return
+	}
+	path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", event.Fd))
+	unix.Close(int(event.Fd))
+	if err != nil || int(event.Pid) == os.Getpid() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writers[filepath.Dir(path)] = processName(int(event.Pid))
+}
+
+// processName returns the command name and PID of a process
+func processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return fmt.Sprintf("pid %d", pid)
+	}
+	return fmt.Sprintf("%s (pid %d)", strings.TrimSpace(string(comm)), pid)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package watch
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterTracker(t *testing.T) {
+	dir := t.TempDir()
+	tracker := newWriterTracker([]string{dir})
+	defer tracker.close()
+	if tracker.file == nil {
+		t.Skip("fanotify is not available")
+	}
+
+	require.NoError(t, exec.Command("sh", "-c", "echo 'version = 2' > "+filepath.Join(dir, "config.toml")).Run())
+
+	var writer string
+	require.Eventually(t, func() bool {
+		writer = tracker.takeWriter(dir)
+		return writer != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, writer, "sh (pid ")
+	require.Empty(t, tracker.takeWriter(dir))
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package artifact pulls kata artifacts from OCI registries, verifies that they can
+// be installed on the host and installs them into a directory.
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/artifact"
+	"github.com/NVIDIA/k8s-kata-manager/internal/cache"
+	"github.com/NVIDIA/k8s-kata-manager/internal/oras"
+	"github.com/NVIDIA/k8s-kata-manager/internal/version"
+)
+
+// Artifact is a resolved kata artifact which has been verified to be installable
+type Artifact struct {
+	ref      string
+	manifest *ocispec.Manifest
+	metadata *artifact.Metadata
+	options
+}
+
+type options struct {
+	creds          *auth.Credential
+	cacheDir       string
+	hostRoot       string
+	maxSize        *resource.Quantity
+	managerVersion string
+}
+
+// Option is a functional option for resolving an artifact
+type Option func(*options)
+
+// WithCredentials sets the credentials used to authenticate with the registry.
+// Artifacts are pulled anonymously by default.
+func WithCredentials(username string, password string) Option {
+	return func(o *options) {
+		o.creds = &auth.Credential{Username: username, Password: password}
+	}
+}
+
+// WithBlobCache sets the directory of the blob cache. Blobs shared by artifacts are
+// only pulled once and hardlinked into the install directories. Artifacts are
+// pulled without cache by default.
+func WithBlobCache(dir string) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+	}
+}
+
+// WithHostRoot sets the path the host root filesystem is mounted at, which is used
+// to check the host features required by an artifact. Defaults to /.
+func WithHostRoot(root string) Option {
+	return func(o *options) {
+		o.hostRoot = root
+	}
+}
+
+// WithMaxSize sets the maximum payload size of an artifact
+func WithMaxSize(size resource.Quantity) Option {
+	return func(o *options) {
+		o.maxSize = &size
+	}
+}
+
+// WithManagerVersion sets the kata manager version checked against the minimum
+// version required by an artifact. Defaults to the version of this module.
+func WithManagerVersion(v string) Option {
+	return func(o *options) {
+		o.managerVersion = v
+	}
+}
+
+// Resolve fetches the manifest of the artifact referenced by ref, e.g.
+// nvcr.io/nvidia/cloud-native/kata-gpu-artifacts:ubuntu22.04-535.54.03, and verifies
+// that the artifact can be installed on the host. It returns a *ResolveError if the
+// manifest cannot be fetched and a *VerifyError if the artifact cannot be installed.
+func Resolve(ctx context.Context, ref string, opts ...Option) (*Artifact, error) {
+	o := options{
+		hostRoot:       "/",
+		managerVersion: version.Get(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	a, err := oras.NewArtifact(ref, "")
+	if err != nil {
+		return nil, &ResolveError{Ref: ref, Err: err}
+	}
+	_, manifest, err := a.Manifest(ctx, o.creds)
+	if err != nil {
+		return nil, &ResolveError{Ref: ref, Err: err}
+	}
+
+	metadata, err := artifact.Verify(manifest, o.managerVersion, o.hostRoot, o.maxSize)
+	if err != nil {
+		return nil, &VerifyError{Ref: ref, Err: err}
+	}
+
+	return &Artifact{
+		ref:      ref,
+		manifest: manifest,
+		metadata: metadata,
+		options:  o,
+	}, nil
+}
+
+// Manifest returns the manifest of the artifact
+func (a *Artifact) Manifest() *ocispec.Manifest {
+	return a.manifest
+}
+
+// Size returns the size of the payload of the artifact in bytes
+func (a *Artifact) Size() int64 {
+	return artifact.PayloadSize(a.manifest)
+}
+
+// Install pulls the artifact into dir and returns the path of its kata
+// configuration file. It returns an *InsufficientSpaceError if dir lacks the space
+// for the artifact and a *PullError if the artifact cannot be pulled.
+func (a *Artifact) Install(ctx context.Context, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating artifact directory: %w", err)
+	}
+
+	o, err := oras.NewArtifact(a.ref, dir)
+	if err != nil {
+		return "", &PullError{Ref: a.ref, Err: err}
+	}
+
+	if a.cacheDir == "" {
+		if err := checkFreeSpace(dir, a.Size()); err != nil {
+			return "", err
+		}
+		if _, err := o.Pull(ctx, a.creds); err != nil {
+			return "", &PullError{Ref: a.ref, Err: err}
+		}
+	} else {
+		blobs, err := cache.New(a.cacheDir)
+		if err != nil {
+			return "", err
+		}
+		if err := checkFreeSpace(dir, artifact.RequiredSpace(a.manifest, blobs)); err != nil {
+			return "", err
+		}
+		if err := o.PullCached(ctx, a.creds, a.manifest, blobs); err != nil {
+			return "", &PullError{Ref: a.ref, Err: err}
+		}
+	}
+
+	return artifact.KataConfigPath(dir, a.metadata.KataConfig)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/artifact"
+)
+
+// ResolveError is returned when the manifest of an artifact cannot be fetched, e.g.
+// because the registry is unreachable or the reference is invalid
+type ResolveError struct {
+	Ref string
+	Err error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("unable to resolve artifact %s: %v", e.Ref, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError is returned when an artifact cannot be installed on the host, e.g.
+// because it requires a newer kata manager, host features which are missing or
+// exceeds the maximum size
+type VerifyError struct {
+	Ref string
+	Err error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("artifact %s cannot be installed: %v", e.Ref, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// PullError is returned when the layers of an artifact cannot be pulled
+type PullError struct {
+	Ref string
+	Err error
+}
+
+func (e *PullError) Error() string {
+	return fmt.Sprintf("unable to pull artifact %s: %v", e.Ref, e.Err)
+}
+
+func (e *PullError) Unwrap() error {
+	return e.Err
+}
+
+// InsufficientSpaceError is returned when the install directory lacks the space
+// for an artifact
+type InsufficientSpaceError struct {
+	// Path is the install directory
+	Path string
+	// Required is the space in bytes needed for the artifact
+	Required int64
+	// Available is the space in bytes available on the filesystem of Path
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return (&artifact.InsufficientSpaceError{Path: e.Path, Required: e.Required, Available: e.Available}).Error()
+}
+
+// checkFreeSpace returns an *InsufficientSpaceError if dir lacks the required space
+func checkFreeSpace(dir string, required int64) error {
+	err := artifact.CheckFreeSpace(dir, required)
+	var spaceErr *artifact.InsufficientSpaceError
+	if errors.As(err, &spaceErr) {
+		return &InsufficientSpaceError{Path: spaceErr.Path, Required: spaceErr.Required, Available: spaceErr.Available}
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package artifact_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/k8s-kata-manager/pkg/artifact"
+)
+
+func Example() {
+	ctx := context.Background()
+
+	a, err := artifact.Resolve(ctx, "nvcr.io/nvidia/cloud-native/kata-gpu-artifacts:ubuntu22.04-535.54.03",
+		artifact.WithBlobCache("/opt/nvidia-gpu-operator/artifacts/runtimeclasses/.blobs"),
+	)
+	var verifyErr *artifact.VerifyError
+	if errors.As(err, &verifyErr) {
+		fmt.Printf("Skipping incompatible artifact: %v\n", verifyErr.Err)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	kataConfig, err := a.Install(ctx, "/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Installed %d bytes, kata config %s\n", a.Size(), kataConfig)
+}
+
+func ExampleResolve_error() {
+	_, err := artifact.Resolve(context.Background(), "not a reference")
+
+	var resolveErr *artifact.ResolveError
+	fmt.Println(errors.As(err, &resolveErr))
+	// Output: true
+}
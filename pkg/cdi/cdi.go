@@ -0,0 +1,87 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cdi generates CDI specifications for the NVIDIA GPUs bound to vfio-pci for
+// passthrough to kata VMs.
+package cdi
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/NVIDIA/go-nvlib/pkg/nvpci"
+	"github.com/NVIDIA/nvidia-container-toolkit/pkg/nvcdi/spec"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/cdi"
+)
+
+// DefaultDir is the directory CDI specifications are read from by the runtimes
+const DefaultDir = "/var/run/cdi"
+
+// Spec is a CDI specification
+type Spec = spec.Interface
+
+// Option is a functional option for generating a CDI specification
+type Option = cdi.Option
+
+// WithVendor sets the vendor of the devices. Defaults to nvidia.com.
+func WithVendor(vendor string) Option {
+	return cdi.WithVendor(vendor)
+}
+
+// WithClass sets the class of the devices. Defaults to pgpu.
+func WithClass(class string) Option {
+	return cdi.WithClass(class)
+}
+
+// WithNvpciLib sets the library used to enumerate the PCI devices of the host
+func WithNvpciLib(lib nvpci.Interface) Option {
+	return cdi.WithNvpciLib(lib)
+}
+
+// GetSpec returns the CDI specification for all NVIDIA GPUs bound to vfio-pci. Each
+// GPU is added under its index, its IOMMU group and, with iommufd, its vfio device.
+func GetSpec(opts ...Option) (Spec, error) {
+	lib, err := cdi.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cdi lib: %w", err)
+	}
+	spec, err := lib.GetSpec()
+	if err != nil {
+		return nil, fmt.Errorf("error getting cdi spec: %w", err)
+	}
+	return spec, nil
+}
+
+// SaveSpec saves the CDI specification for all NVIDIA GPUs bound to vfio-pci to dir
+// and returns the path of the specification
+func SaveSpec(dir string, opts ...Option) (string, error) {
+	spec, err := GetSpec(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := cdiapi.GenerateNameForSpec(spec.Raw())
+	if err != nil {
+		return "", fmt.Errorf("failed to generate cdi spec name: %w", err)
+	}
+	path := filepath.Join(dir, name+".yaml")
+	if err := spec.Save(path); err != nil {
+		return "", fmt.Errorf("failed to save cdi spec: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdi_test
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/k8s-kata-manager/pkg/cdi"
+)
+
+func ExampleSaveSpec() {
+	path, err := cdi.SaveSpec(cdi.DefaultDir,
+		cdi.WithVendor("nvidia.com"),
+		cdi.WithClass("pgpu"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Saved CDI specification to %s\n", path)
+}
+
+func ExampleGetSpec() {
+	spec, err := cdi.GetSpec()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, device := range spec.Raw().Devices {
+		fmt.Printf("%s=%s\n", spec.Raw().Kind, device.Name)
+	}
+}
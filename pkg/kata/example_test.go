@@ -0,0 +1,88 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kata_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml"
+
+	"github.com/NVIDIA/k8s-kata-manager/pkg/kata"
+)
+
+// debugTransformer enables debug logging of the hypervisors
+type debugTransformer struct{}
+
+func (debugTransformer) Transform(config *toml.Tree) error {
+	hypervisors, ok := config.Get("hypervisor").(*toml.Tree)
+	if !ok {
+		return fmt.Errorf("no hypervisor configured")
+	}
+	for _, name := range hypervisors.Keys() {
+		config.SetPath([]string{"hypervisor", name, "enable_debug"}, true)
+	}
+	return nil
+}
+
+func ExampleTransformFile() {
+	dir, err := os.MkdirTemp("", "kata")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "configuration-kata-qemu.toml")
+	config := "[hypervisor.qemu]\nkernel = \"/opt/kata/share/kata-containers/vmlinux.container\"\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = kata.TransformFile(path,
+		kata.WithArtifactsRoot("/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu"),
+		kata.WithTransformers(debugTransformer{}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	transformed, err := toml.LoadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(transformed.Get("hypervisor.qemu.kernel"))
+	fmt.Println(transformed.Get("hypervisor.qemu.enable_debug"))
+	// Output:
+	// /opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu/vmlinux.container
+	// true
+}
+
+func ExampleTransformFile_error() {
+	err := kata.TransformFile("/nonexistent/configuration-kata-qemu.toml")
+
+	var transformErr *kata.TransformError
+	if errors.As(err, &transformErr) {
+		fmt.Println(transformErr.Path)
+	}
+	// Output: /nonexistent/configuration-kata-qemu.toml
+}
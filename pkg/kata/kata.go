@@ -0,0 +1,91 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kata transforms kata configuration files so that they can be used from
+// the directory the kata artifacts are installed in.
+package kata
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/kata/transform"
+)
+
+// Transformer applies a transform to a kata configuration in-place
+type Transformer = transform.Transformer
+
+type options struct {
+	artifactsRoot string
+	transformers  []Transformer
+}
+
+// Option is a functional option for transforming a kata configuration file
+type Option func(*options)
+
+// WithArtifactsRoot sets the directory the kernel, image and initrd paths of the
+// hypervisors are pointed to. Defaults to the directory of the configuration file.
+func WithArtifactsRoot(root string) Option {
+	return func(o *options) {
+		o.artifactsRoot = root
+	}
+}
+
+// WithTransformers appends transformers which are applied after the artifacts root
+// has been updated
+func WithTransformers(transformers ...Transformer) Option {
+	return func(o *options) {
+		o.transformers = append(o.transformers, transformers...)
+	}
+}
+
+// NewArtifactsRootTransformer returns a transformer pointing the kernel, image and
+// initrd paths of the hypervisors to root
+func NewArtifactsRootTransformer(root string) Transformer {
+	return transform.NewArtifactsRootTransformer(root)
+}
+
+// TransformFile transforms the kata configuration file at path in-place. The file
+// is replaced atomically, so that a file hardlinked from a blob cache is left
+// untouched. It returns a *TransformError on failure.
+func TransformFile(path string, opts ...Option) error {
+	o := options{
+		artifactsRoot: filepath.Dir(path),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	transformers := append([]Transformer{transform.NewArtifactsRootTransformer(o.artifactsRoot)}, o.transformers...)
+	if err := transform.TransformFile(path, path, transformers...); err != nil {
+		return &TransformError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// TransformError is returned when a kata configuration file cannot be transformed
+type TransformError struct {
+	Path string
+	Err  error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("unable to transform kata configuration %s: %v", e.Path, e.Err)
+}
+
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
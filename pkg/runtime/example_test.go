@@ -0,0 +1,123 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runtime_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/NVIDIA/k8s-kata-manager/pkg/runtime"
+)
+
+func ExampleNewContainerd() {
+	dir, err := os.MkdirTemp("", "containerd")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("version = 2\n"), 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	config, err := runtime.NewContainerd(path,
+		runtime.WithBackupDir(filepath.Join(dir, "backup")),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = config.AddRuntime("kata-qemu-nvidia-gpu",
+		"/opt/nvidia-gpu-operator/artifacts/runtimeclasses/kata-qemu-nvidia-gpu/configuration-kata-qemu-nvidia-gpu.toml",
+		runtime.RuntimeClassOptions{},
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	changes, err := config.Changes()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, c := range changes {
+		fmt.Printf("%s modified: %v\n", filepath.Base(c.Path), c.Modified())
+	}
+
+	// The runtime has to be restarted with config.Restart for the saved config to
+	// apply
+	if _, err := config.Save(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// Output:
+	// config.toml modified: true
+}
+
+func ExampleNewCRIO() {
+	config, err := runtime.NewCRIO("/etc/crio/crio.conf.d/99-nvidia-kata.conf",
+		runtime.WithSocket("/var/run/crio/crio.sock"),
+		runtime.WithBackupDir("/opt/nvidia-gpu-operator/artifacts/runtimeclasses/.backup"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := config.RemoveRuntime("kata-qemu-nvidia-gpu"); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := config.Save(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := config.Restart(context.Background()); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func ExampleNewRestarter() {
+	restarter, err := runtime.NewRestarter(runtime.RestarterOptions{
+		Strategy: runtime.RestartSystemd,
+		Unit:     "containerd.service",
+		Socket:   "/run/containerd/containerd.sock",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	config, err := runtime.NewContainerd("/etc/containerd/config.toml",
+		runtime.WithSocket("/run/containerd/containerd.sock"),
+		runtime.WithRestarter(restarter),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := config.Restart(context.Background()); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c), NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package runtime edits the config of containerd and CRI-O to add kata runtime
+// classes and to remove them again.
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/containerd"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/crio"
+	"github.com/NVIDIA/k8s-kata-manager/internal/runtime/restart"
+)
+
+const (
+	defaultContainerdRuntimeType = "io.containerd.kata.v2"
+	defaultCrioRuntimeType       = "vm"
+)
+
+// defaultPodAnnotations are the pod annotations passed to the kata runtimes
+var defaultPodAnnotations = []string{"io.katacontainers.*"}
+
+// Config is the config of a container runtime. Changes are only written by Save and
+// only applied by Restart.
+type Config interface {
+	// AddRuntime adds a kata runtime using the kata configuration file at path
+	AddRuntime(name string, path string, opts RuntimeClassOptions) error
+	// DefaultRuntime returns the name of the default runtime
+	DefaultRuntime() string
+	// RemoveRuntime removes a runtime, restoring the settings it had before it was
+	// first changed
+	RemoveRuntime(name string) error
+	// Save writes the config and returns the number of bytes written
+	Save() (int64, error)
+	// Unchanged returns true if the last Save found the config files to already hold
+	// the updated config, in which case Restart does not restart the runtime
+	Unchanged() bool
+	// Restart restarts the runtime and returns once the runtime is ready again or the
+	// context is done
+	Restart(ctx context.Context) error
+	// Rollback restores the config to its content before the last Save. The runtime
+	// has to be restarted for the restored config to apply.
+	Rollback() error
+	// Changes returns the changes Save would make to the config files, without
+	// writing them
+	Changes() ([]FileChange, error)
+}
+
+// RuntimeClassOptions are the settings of a runtime class added to the config
+type RuntimeClassOptions struct {
+	// RuntimeType overrides the runtime type of the kata runtimes
+	RuntimeType string
+	// RuntimePath is the path to the runtime (shim) binary
+	RuntimePath string
+	// Snapshotter is the snapshotter used for containers of the runtime class
+	Snapshotter string
+	// PodAnnotations overrides the pod annotations passed to the kata runtimes
+	PodAnnotations []string
+	// ContainerAnnotations is the list of container annotations passed to the runtime
+	ContainerAnnotations []string
+	// SandboxMode is the sandbox mode of the runtime
+	SandboxMode string
+	// PrivilegedWithoutHostDevices prevents host devices from being passed to privileged containers
+	PrivilegedWithoutHostDevices *bool
+	// SystemdCgroup configures the shim to use the systemd cgroup driver
+	SystemdCgroup *bool
+	// CgroupWritable makes the cgroup hierarchy writable from within the container
+	CgroupWritable *bool
+	// MonitorCgroup is the cgroup used for the container monitor process
+	MonitorCgroup string
+	// SetAsDefault configures the runtime class as the default runtime
+	SetAsDefault bool
+}
+
+// FileChange describes the change Save makes to a config file. Old is nil if the
+// file does not exist and New is nil if the file is removed.
+type FileChange struct {
+	Path string
+	Old  []byte
+	New  []byte
+}
+
+// Changed returns true if the content or existence of the file changes
+func (f FileChange) Changed() bool {
+	return runtime.FileChange(f).Changed()
+}
+
+// Modified returns true if the settings or existence of the file change; changes to
+// formatting and comments only are ignored
+func (f FileChange) Modified() bool {
+	return runtime.FileChange(f).Modified()
+}
+
+// Restarter restarts the container runtime so that it picks up config changes
+type Restarter interface {
+	// Restart restarts or reloads the runtime and waits for its socket to become
+	// healthy again
+	Restart(ctx context.Context) error
+}
+
+// Names of the restart strategies of NewRestarter
+const (
+	// RestartSignal sends a SIGHUP to the process serving the runtime socket, which
+	// makes containerd exit so that its service manager restarts it
+	RestartSignal = restart.Signal
+	// RestartSystemd restarts the systemd unit of the runtime through D-Bus
+	RestartSystemd = restart.SystemdRestart
+	// ReloadSystemd reloads the systemd unit of the runtime through D-Bus
+	ReloadSystemd = restart.SystemdReload
+	// RestartCommand runs a custom command on the host
+	RestartCommand = restart.Command
+	// RestartNone leaves restarting the runtime to the caller
+	RestartNone = restart.None
+)
+
+// RestarterOptions configures a restart strategy
+type RestarterOptions struct {
+	// Strategy is the name of the strategy, e.g. RestartSystemd
+	Strategy string
+	// Socket is the CRI socket of the runtime, which is polled until the runtime is
+	// healthy again
+	Socket string
+	// Unit is the systemd unit of the runtime
+	Unit string
+	// Command is the shell command run on the host
+	Command string
+	// HostRoot is the path the host root filesystem is mounted at; the systemd calls
+	// and commands are run on the host through it
+	HostRoot string
+	// Timeout bounds the time waited for the runtime socket to become healthy; it
+	// defaults to two minutes
+	Timeout time.Duration
+}
+
+// NewRestarter returns the restart strategy described by the options
+func NewRestarter(o RestarterOptions) (Restarter, error) {
+	return restart.New(restart.Options{
+		Strategy: o.Strategy,
+		Socket:   o.Socket,
+		Unit:     o.Unit,
+		Command:  o.Command,
+		HostRoot: o.HostRoot,
+		Timeout:  o.Timeout,
+	})
+}
+
+// config converts between the types of the package and those of the runtime config
+// it wraps
+type config struct {
+	runtime.Runtime
+}
+
+func (c config) AddRuntime(name string, path string, opts RuntimeClassOptions) error {
+	return c.Runtime.AddRuntime(name, path, runtime.RuntimeClassOptions(opts))
+}
+
+func (c config) Changes() ([]FileChange, error) {
+	changes, err := c.Runtime.Changes()
+	if err != nil {
+		return nil, err
+	}
+	var converted []FileChange
+	for _, change := range changes {
+		converted = append(converted, FileChange(change))
+	}
+	return converted, nil
+}
+
+type options struct {
+	dropIn         string
+	socket         string
+	backupDir      string
+	runtimeType    string
+	podAnnotations []string
+	restarter      Restarter
+	hostRoot       string
+}
+
+// Option is a functional option for loading a runtime config
+type Option func(*options)
+
+// WithDropIn writes the kata runtimes to a drop-in file imported by the containerd
+// config instead of editing the containerd config directly, which requires
+// containerd config version 3. It is ignored for CRI-O, whose config is always a
+// drop-in file.
+func WithDropIn(path string) Option {
+	return func(o *options) {
+		o.dropIn = path
+	}
+}
+
+// WithSocket sets the CRI socket of the runtime, which is used to wait for the
+// runtime to become healthy after a restart
+func WithSocket(socket string) Option {
+	return func(o *options) {
+		o.socket = socket
+	}
+}
+
+// WithBackupDir sets the directory in which the original config files are backed
+// up before they are first modified. Nothing is backed up by default.
+func WithBackupDir(dir string) Option {
+	return func(o *options) {
+		o.backupDir = dir
+	}
+}
+
+// WithRuntimeType sets the default runtime type of the kata runtimes
+func WithRuntimeType(runtimeType string) Option {
+	return func(o *options) {
+		o.runtimeType = runtimeType
+	}
+}
+
+// WithPodAnnotations sets the default pod annotations passed to the kata runtimes
+func WithPodAnnotations(annotations ...string) Option {
+	return func(o *options) {
+		o.podAnnotations = annotations
+	}
+}
+
+// WithRestarter sets how the runtime is restarted. By default, containerd is sent
+// a SIGHUP, on which it exits to be restarted by its service manager, and the crio
+// systemd unit is restarted.
+func WithRestarter(restarter Restarter) Option {
+	return func(o *options) {
+		o.restarter = restarter
+	}
+}
+
+// WithHostRoot sets the path the host root filesystem is mounted at, for configs
+// edited from a container. The config, drop-in, socket and backup paths are local
+// paths below it, while the paths written to the config files and recorded in the
+// backups are paths on the host. The host is the local root by default.
+func WithHostRoot(root string) Option {
+	return func(o *options) {
+		o.hostRoot = root
+	}
+}
+
+// NewContainerd loads the containerd config file at path. It returns a
+// *ConfigError if the config cannot be loaded.
+func NewContainerd(path string, opts ...Option) (Config, error) {
+	o := newOptions(defaultContainerdRuntimeType, opts...)
+	c, err := containerd.Setup(&runtime.Options{
+		Path:           path,
+		DropInPath:     o.dropIn,
+		RuntimeType:    o.runtimeType,
+		PodAnnotations: o.podAnnotations,
+		Socket:         o.socket,
+		BackupDir:      o.backupDir,
+		Restarter:      o.restarter,
+		HostRoot:       o.hostRoot,
+	})
+	if err != nil {
+		return nil, &ConfigError{Path: path, Err: err}
+	}
+	return config{c}, nil
+}
+
+// NewCRIO loads the CRI-O drop-in config file at path, which does not need to
+// exist yet. It returns a *ConfigError if the config cannot be loaded.
+func NewCRIO(path string, opts ...Option) (Config, error) {
+	o := newOptions(defaultCrioRuntimeType, opts...)
+	c, err := crio.Setup(&runtime.Options{
+		Path:           path,
+		RuntimeType:    o.runtimeType,
+		PodAnnotations: o.podAnnotations,
+		Socket:         o.socket,
+		BackupDir:      o.backupDir,
+		Restarter:      o.restarter,
+		HostRoot:       o.hostRoot,
+	})
+	if err != nil {
+		return nil, &ConfigError{Path: path, Err: err}
+	}
+	return config{c}, nil
+}
+
+func newOptions(runtimeType string, opts ...Option) *options {
+	o := &options{
+		runtimeType:    runtimeType,
+		podAnnotations: defaultPodAnnotations,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ConfigError is returned when a runtime config cannot be loaded
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("unable to load runtime config %s: %v", e.Path, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}